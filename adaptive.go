@@ -0,0 +1,75 @@
+package go_pool
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	adaptiveWindowSize = 64   // 动态 PoolTimeout 参考最近的获取次数
+	adaptivePercentile = 0.99 // 参考的耗时分位数
+	adaptiveFactor     = 2    // 动态 PoolTimeout = 分位数耗时 * adaptiveFactor
+)
+
+// latencyWindow 记录最近的获取连接耗时
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+	full    bool
+}
+
+func newLatencyWindow(size int) *latencyWindow {
+	return &latencyWindow{
+		samples: make([]time.Duration, size),
+	}
+}
+
+func (w *latencyWindow) record(d time.Duration) {
+	w.mu.Lock()
+	w.samples[w.next] = d
+	w.next++
+	if w.next == len(w.samples) {
+		w.next = 0
+		w.full = true
+	}
+	w.mu.Unlock()
+}
+
+// percentile 最近耗时的 p 分位数，没有数据时返回 false
+func (w *latencyWindow) percentile(p float64) (time.Duration, bool) {
+	w.mu.Lock()
+	n := w.next
+	if w.full {
+		n = len(w.samples)
+	}
+	sorted := make([]time.Duration, n)
+	copy(sorted, w.samples[:n])
+	w.mu.Unlock()
+
+	if n == 0 {
+		return 0, false
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(float64(n-1)*p)], true
+}
+
+// currentPoolTimeout 当前生效的 PoolTimeout
+func (c *channelPool) currentPoolTimeout() time.Duration {
+	if c.latencies == nil {
+		return c.poolTimeout
+	}
+
+	timeout := c.poolTimeout
+	if d, ok := c.latencies.percentile(adaptivePercentile); ok {
+		timeout = d * adaptiveFactor
+	}
+	if timeout < c.minPoolTimeout {
+		return c.minPoolTimeout
+	}
+	if timeout > c.maxPoolTimeout {
+		return c.maxPoolTimeout
+	}
+	return timeout
+}
@@ -0,0 +1,42 @@
+package go_pool
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff 重试间隔策略，attempt 从 0 开始
+type Backoff interface {
+	NextBackoff(attempt int) time.Duration
+}
+
+// ExponentialBackoff 指数增长的重试间隔，第 attempt 次为 Base*2^attempt，不超过 Max，
+// 实际间隔在其一半到全部之间随机，避免同时重试
+type ExponentialBackoff struct {
+	Base time.Duration
+	Max  time.Duration // 0 表示不限制
+}
+
+func (b *ExponentialBackoff) NextBackoff(attempt int) time.Duration {
+	if b.Base <= 0 {
+		return 0
+	}
+
+	d := b.Base
+	for i := 0; i < attempt; i++ {
+		if b.Max > 0 && d >= b.Max {
+			break
+		}
+		// 溢出时停止增长
+		if d*2 < d {
+			break
+		}
+		d *= 2
+	}
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
@@ -0,0 +1,22 @@
+package go_pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	b := &ExponentialBackoff{Base: 10 * time.Millisecond, Max: 50 * time.Millisecond}
+	for attempt, max := range []time.Duration{10, 20, 40, 50, 50} {
+		max *= time.Millisecond
+		for i := 0; i < 100; i++ {
+			if d := b.NextBackoff(attempt); d < max/2 || d > max {
+				t.Fatalf("NextBackoff(%d) was %s but should be in [%s, %s]", attempt, d, max/2, max)
+			}
+		}
+	}
+
+	if d := (&ExponentialBackoff{}).NextBackoff(3); d != 0 {
+		t.Errorf("NextBackoff without Base was %s but should be 0", d)
+	}
+}
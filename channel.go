@@ -1,9 +1,12 @@
 package go_pool
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"io"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,215 +16,1815 @@ type Config struct {
 	InitialCap int
 	//连接池中拥有的最大的连接数
 	MaxCap int
-	//
+	//同时存活（包括已取出）的连接数最多为 ConcurrentBase*MaxCap，为 1 时严格以 MaxCap 为上限，默认 2，不能为负数
 	ConcurrentBase int
 	//生成连接的方法
 	Factory func() (interface{}, error)
+	//生成连接的方法，ctx 为 GetContext 的 ctx，后台新建连接时为 context.Background()，设置后代替 Factory
+	FactoryContext func(ctx context.Context) (interface{}, error)
+	//生成连接并返回连接标签的方法，设置后代替 Factory
+	TagFactory func() (interface{}, string, error)
+	//生成连接失败时依次尝试的备用方法，全部失败才算生成失败
+	//由备用方法生成的连接元数据中 "fallback" 为该方法在 Fallbacks 中的下标
+	Fallbacks []func() (interface{}, error)
+	//生成连接并返回连接元数据的方法，元数据通过 IdleConn.Meta 读取，设置后代替 Factory 和 TagFactory
+	FactoryMeta func() (interface{}, map[string]interface{}, error)
 	//关闭连接的方法
 	Close func(interface{}) error
+	//为 true 时 Close 可以为 nil，此时连接必须实现 io.Closer，通过其 Close 方法关闭
+	DefaultCloseViaIOCloser bool
 	//检查连接是否有效的方法
 	Ping func(interface{}) error
+	//Ping 的超时时间，超时视为 Ping 失败，0 表示不限制
+	//超时后 Ping 在后台继续运行直到返回，Ping 应在连接被关闭后尽快返回，避免 goroutine 长时间滞留
+	PingTimeout time.Duration
 	//连接最大空闲时间，超过该时间则将失效，根据上次使用时间判断，不设置不检查
 	IdleTimeout time.Duration
+	//每个连接的空闲超时时间在 [IdleTimeout, IdleTimeout+IdleTimeoutJitter) 之间随机，避免同时创建的连接同时超时
+	IdleTimeoutJitter time.Duration
 	//获取连接的超时时间，默认 1s
 	PoolTimeout time.Duration
-	// conn 检测时间，默认 30m , -1 = disable // TODO ...
+	// conn 检测时间，默认 30m , -1 = disable
 	IdleCheckFrequency time.Duration
+	//空闲连接数低于该值时后台补充连接，0 表示不启用
+	LowWatermark int
+	//后台补充连接时补到该空闲连接数为止，不能小于 LowWatermark 或超过 MaxCap
+	HighWatermark int
+	//为 true 时 PoolTimeout、IdleCheckFrequency、ConcurrentBase 必须显式设置，不使用默认值
+	StrictConfig bool
+	//Release 等待连接关闭的最长时间，超时后剩余连接在后台关闭，0 表示一直等待
+	ReleaseCloseTimeout time.Duration
+	//日志输出，默认输出到标准错误
+	Logger Logger
+	//连接最大存活时间，根据创建时间判断，不设置不检查
+	MaxConnLifetime time.Duration
+	//为 true 时 NewChannelPool 返回后在后台新建连接，直到空闲连接数达到 WarmupTarget，未设置 WarmupTarget 时为 MinIdle
+	//生成连接失败时通过 Logger 输出，完成后 Ready 返回的 channel 关闭
+	LazyWarmup   bool
+	WarmupTarget int
+	//后台保持的最小空闲连接数，不能超过 MaxCap，0 表示不启用
+	MinIdle int
+	//检查 MinIdle 的间隔，默认 1s
+	MinIdleCheckFrequency time.Duration
+	//Get 复用空闲连接时调用，idleFor 为该连接的空闲时间，新建的连接不调用
+	OnReuse func(conn interface{}, idleFor time.Duration)
+	//为 true 时 Put 先调用 Ping 检查连接，失效则关闭而不放回，Ping 为 nil 时无效
+	PingOnPut bool
+	//Get 时距离 IdleTimeout 不足该时间的空闲连接也视为超时，避免取到即将失效的连接，不能为负数，设置了 IdleTimeout 时须小于 IdleTimeout
+	ExpiryGrace time.Duration
+	//每次 Get 最多检查的空闲连接数，超过后不再复用空闲连接而是等待新建，0 表示不限制
+	MaxPingAttemptsPerGet int
+	//为 true 时先放回的空闲连接先取出，默认优先取出最近放回的连接，便于多余的连接因 IdleTimeout 被回收
+	PoolFIFO bool
+	//为 true 时没有可用的连接 Get 一直等待，不受 PoolTimeout 限制，连接池 Release 或关闭时返回 ErrPoolClosed
+	WaitForConn bool
+	//同时阻塞等待的 Get 的最大数量，超过时 Get 立即返回 ErrTooManyWaiters，0 表示不限制
+	MaxWaiters int
+	//每个连接占用内存的估计值，用于 EstimatedMemory
+	PerConnBytes int64
+	//每秒最多新建的连接数，CreateBurst 为最多可以连续新建的数量，默认 1，0 表示不限制
+	//Get 在 PoolTimeout 内等待，后台补充连接和 TryGet 不等待
+	MaxCreateRate float64
+	CreateBurst   int
+	//每秒最多新建的连接数，超过时 Get 不等待而是立即返回 ErrRateLimited，0 表示不限制，不能与 MaxCreateRate 同时设置
+	NewConnRateLimit int
+	//连接被 Get 取出的最大次数，达到后放回时关闭，0 表示不限制
+	MaxConnUses int
+	//Put 时调用，返回 false 则关闭连接而不放回，lastErr 为取出期间最近一次 Ping 的错误
+	RetainOnPut func(conn interface{}, age time.Duration, uses int, lastErr error) bool
+	//后台 Ping 空闲连接的间隔，关闭失效的连接并补充到 MinIdle，0 表示不启用，Ping 为 nil 时无效
+	HealthCheckFrequency time.Duration
+	//后台每隔 KeepAliveFrequency 对空闲连接调用 KeepAliveFunc，避免服务端关闭空闲连接，返回错误则关闭该连接
+	//不改变连接的空闲时间，设置 KeepAliveFunc 时 KeepAliveFrequency 必须大于 0
+	KeepAliveFunc      func(conn interface{}) error
+	KeepAliveFrequency time.Duration
+	//Get 返回连接前调用，返回错误则关闭该连接，取自空闲连接时继续取下一个连接，新建的连接则由 Get 返回该错误
+	OnGet func(conn interface{}) error
+	//Put 放回连接前调用，返回错误则关闭连接而不放回
+	OnPut func(conn interface{}) error
+	//为 true 时记录每次取出连接的序号，Put 的 IdleConn 不是该连接最近一次取出的则返回 ErrConnReused，
+	//仍被取出的连接再次被 Get 取出时 panic，用于排查重复使用连接的问题
+	DetectReuse bool
+	//Get 返回连接前包装连接，IdleConn.Get 返回包装后的连接，连接池中保存的仍是原来的连接，返回错误则关闭该连接
+	Wrap func(conn interface{}) (interface{}, error)
+	//Put 时取回 Wrap 包装前的连接放回连接池，返回错误则关闭连接而不放回，不设置时直接放回原来的连接
+	Unwrap func(wrapped interface{}) (interface{}, error)
+	//连接取出超过该时间仍未放回时通过 Logger 输出，每次取出只输出一次，0 表示不检测
+	ConnLeakThreshold time.Duration
+	//为 true 时记录取出连接时的调用栈并一同输出，每次 Get 都会获取调用栈，开销较大
+	ConnLeakStack bool
+	//ClosePool 时以最后一次的统计数据调用
+	OnStats func(Stats)
+	//连接池绑定的 context，取消后自动 ClosePool，不设置不监听
+	Context context.Context
+	//连接被永久关闭时调用，reason 为关闭原因
+	OnClose func(conn interface{}, reason CloseReason)
+	//创建连接时获取远端地址并缓存，用于 Dump 等诊断信息，不设置不获取
+	AddrOf func(conn interface{}) string
+	//生成连接失败时的重试次数和重试间隔，连接池 Release 或关闭时停止重试
+	ConnectRetries      int
+	ConnectRetryBackoff time.Duration
+	//重试间隔策略，默认为以 ConnectRetryBackoff 为基数的 ExponentialBackoff
+	Backoff Backoff
+	//为 true 时 InitialCap 中的连接生成失败只记录日志，NewChannelPool 仍返回连接池和包装了 ErrPartialFill 的错误
+	AllowPartialFill bool
+	//为 true 时根据最近获取连接的耗时动态调整 PoolTimeout，范围为 [MinPoolTimeout, MaxPoolTimeout]
+	AdaptiveTimeout bool
+	MinPoolTimeout  time.Duration
+	MaxPoolTimeout  time.Duration
 }
 
 // channelPool 存放连接信息
 type channelPool struct {
+	growthEvents uint64 // 原子操作，放在首位保证 64 位对齐
+	lastID       uint64 // 最近分配的连接 id
+	waitDuration int64  // Get 阻塞等待的累计时间
+	doublePuts   uint64 // Put 已放回或关闭的连接的次数
+	hits         uint64 // Get 复用空闲连接的次数
+	misses       uint64 // Get 新建连接的次数
+	timeouts     uint64 // Get 返回 ErrPoolTimeout 的次数
+	generation   uint64 // Release 和 InvalidateAll 的次数
+	waitCount    uint32 // Get 阻塞等待的次数，64 位字段需放在此之前
+	waiting      int32  // 正在阻塞等待的 Get 数量，MaxWaiters 为 0 时不统计
+
 	mu sync.RWMutex
 
-	initTime time.Time     // pool 初始化时间，release 之后重置
-	queue    chan struct{} // 考虑存活的 conn 数量，可以是 poolSize 的 concurrentBase 倍数，需要控制 conn 的数量
-	conns    chan *IdleConn
+	quiesced int32 // Quiesce 之后不再提供和创建连接
+	closed   int32 // ClosePool 之后永久关闭
+
+	creationDisabled int32 // DisableCreation 之后只使用空闲连接，不再新建
+
+	initTime time.Time                     // pool 初始化时间，release 之后重置
+	queue    atomic.Pointer[chan struct{}] // 考虑存活的 conn 数量，可以是 poolSize 的 concurrentBase 倍数，需要控制 conn 的数量，Release 后重新分配
+	idle     atomic.Pointer[idleList]      // Get 无锁读取，更换时需持有 mu 写锁，nil 表示连接池已关闭
+
+	bgMu     sync.Mutex
+	bg       *background   // 当前一轮后台 goroutine，Release 后重新启动
+	warmCh   chan struct{} // 空闲连接低于 lowWatermark 时通知后台补充
+	closedCh chan struct{} // ClosePool 后关闭
+
+	readyCh   chan struct{} // WarmupAsync 达到目标后关闭
+	readyOnce sync.Once
+
+	finalStatsOnce sync.Once
+
+	recreateMu  sync.Mutex
+	recreateIDs map[uint64]struct{} // 放回时需要替换的连接 id
+	liveIDs     map[uint64]struct{} // 存活连接的 id，RecreateByID 只标记存活的连接
+
+	leaks *leakTracker // ConnLeakThreshold 时记录已取出的连接，nil 表示不检测
+
+	checkoutMu   sync.Mutex
+	checkouts    map[uint64]uint64 // DetectReuse 时记录已取出的连接 id 及其取出序号，nil 表示不检测
+	lastCheckout uint64
+
+	initialCap          int
+	factory             func(context.Context) (interface{}, error)
+	tagFactory          func() (interface{}, string, error)
+	metaFactory         func() (interface{}, map[string]interface{}, error)
+	fallbacks           []func() (interface{}, error)
+	close               func(interface{}) error
+	ping                func(interface{}) error
+	pingTimeout         time.Duration
+	idleTimeout         time.Duration
+	idleTimeoutJitter   time.Duration
+	poolTimeout         time.Duration
+	idleCheckFrequency  time.Duration
+	minIdleFrequency    time.Duration
+	healthFrequency     time.Duration
+	keepAliveFrequency  time.Duration
+	lowWatermark        int
+	highWatermark       int
+	releaseCloseTimeout time.Duration
+	logger              Logger
+	minPoolTimeout      time.Duration
+	maxPoolTimeout      time.Duration
+	latencies           *latencyWindow // 不为 nil 时启用 AdaptiveTimeout
+
+	maxPingAttempts int
+	requireCloser   bool
+	maxConnLifetime time.Duration
+	minIdle         int
+	onReuse         func(conn interface{}, idleFor time.Duration)
+	pingOnPut       bool
+	expiryGrace     time.Duration
+	onClose         func(conn interface{}, reason CloseReason)
+	addrOf          func(conn interface{}) string
+	connectRetries  int
+	connectBackoff  Backoff
+	waitForConn     bool
+	perConnBytes    int64
+	createLimiter   *tokenBucket // 不为 nil 时限制新建连接的速率
+	createFailFast  bool         // 没有令牌时不等待，返回 ErrRateLimited
+	maxConnUses     int
+	retainOnPut     func(conn interface{}, age time.Duration, uses int, lastErr error) bool
+	onStats         func(Stats)
+	onGet           func(conn interface{}) error
+	maxWaiters      int
+	wrap            func(conn interface{}) (interface{}, error)
+	unwrapConn      func(wrapped interface{}) (interface{}, error)
+	onPut           func(conn interface{}) error
+	keepAlive       func(conn interface{}) error
+}
+
+// Validate 检查配置，返回的错误可以通过 errors.Is 判断具体的问题，NewChannelPool 会先调用 Validate
+func (poolConfig *Config) Validate() error {
+	if poolConfig.InitialCap < 0 || poolConfig.MaxCap <= 0 || poolConfig.InitialCap > poolConfig.MaxCap {
+		return ErrInvalidCapacity
+	}
+	if poolConfig.ConcurrentBase < 0 || (poolConfig.StrictConfig && poolConfig.ConcurrentBase == 0) {
+		return ErrInvalidConcurrentBase
+	}
+	if poolConfig.Factory == nil && poolConfig.FactoryContext == nil && poolConfig.TagFactory == nil &&
+		poolConfig.FactoryMeta == nil {
+		return ErrNilFactory
+	}
+	if poolConfig.Close == nil && !poolConfig.DefaultCloseViaIOCloser {
+		return ErrNilClose
+	}
+	if poolConfig.LowWatermark < 0 || (poolConfig.LowWatermark > 0 &&
+		(poolConfig.HighWatermark < poolConfig.LowWatermark || poolConfig.HighWatermark > poolConfig.MaxCap)) {
+		return ErrInvalidWatermark
+	}
+	if poolConfig.MinIdle < 0 || poolConfig.MinIdle > poolConfig.MaxCap {
+		return ErrMinIdleExceedsMax
+	}
+	if poolConfig.WarmupTarget < 0 || poolConfig.WarmupTarget > poolConfig.MaxCap {
+		return ErrInvalidWarmupTarget
+	}
+	if poolConfig.ConnectRetries < 0 || poolConfig.ConnectRetryBackoff < 0 {
+		return ErrInvalidConnectRetry
+	}
+	if poolConfig.MaxConnUses < 0 {
+		return ErrInvalidMaxConnUses
+	}
+	if poolConfig.MaxWaiters < 0 {
+		return ErrInvalidMaxWaiters
+	}
+	if poolConfig.ConnLeakThreshold < 0 {
+		return ErrInvalidConnLeakThreshold
+	}
+	if poolConfig.ExpiryGrace < 0 || (poolConfig.IdleTimeout > 0 && poolConfig.ExpiryGrace >= poolConfig.IdleTimeout) {
+		return ErrInvalidExpiryGrace
+	}
+	if poolConfig.KeepAliveFrequency < 0 || (poolConfig.KeepAliveFunc != nil && poolConfig.KeepAliveFrequency == 0) {
+		return ErrInvalidKeepAlive
+	}
+	if poolConfig.MaxCreateRate < 0 || poolConfig.CreateBurst < 0 || poolConfig.NewConnRateLimit < 0 ||
+		(poolConfig.MaxCreateRate > 0 && poolConfig.NewConnRateLimit > 0) {
+		return ErrInvalidCreateRate
+	}
+	if poolConfig.AdaptiveTimeout &&
+		(poolConfig.MinPoolTimeout <= 0 || poolConfig.MaxPoolTimeout < poolConfig.MinPoolTimeout) {
+		return ErrInvalidAdaptiveTimeout
+	}
+	if poolConfig.StrictConfig {
+		if poolConfig.PoolTimeout <= 0 {
+			return ErrInvalidPoolTimeout
+		}
+		if poolConfig.IdleCheckFrequency == 0 {
+			return ErrInvalidIdleCheckFrequency
+		}
+	}
+	return nil
+}
+
+// NewChannelPool 初始化连接
+func NewChannelPool(poolConfig *Config) (Pool, error) {
+	if err := poolConfig.Validate(); err != nil {
+		return nil, err
+	}
+	if poolConfig.Close == nil {
+		poolConfig.Close = closeViaIOCloser
+	}
+
+	if poolConfig.PoolTimeout <= 0 {
+		poolConfig.PoolTimeout = PoolTimeoutInit
+	}
+
+	if poolConfig.IdleCheckFrequency == 0 {
+		poolConfig.IdleCheckFrequency = IdleCheckInit
+	}
+
+	if poolConfig.ConcurrentBase <= 0 {
+		poolConfig.ConcurrentBase = 2
+	}
+
+	if poolConfig.MinIdleCheckFrequency <= 0 {
+		poolConfig.MinIdleCheckFrequency = MinIdleCheckInit
+	}
+
+	if poolConfig.Backoff == nil {
+		poolConfig.Backoff = &ExponentialBackoff{Base: poolConfig.ConnectRetryBackoff}
+	}
+
+	if poolConfig.Logger == nil {
+		poolConfig.Logger = defaultLogger
+	}
+
+	idle := newIdleList(poolConfig.MaxCap, poolConfig.PoolFIFO)
+	c := &channelPool{
+		initTime: time.Now(),
+		bg:       stoppedBackground(),
+		warmCh:   make(chan struct{}, 1),
+		closedCh: make(chan struct{}),
+		readyCh:  make(chan struct{}),
+
+		recreateIDs: make(map[uint64]struct{}),
+		liveIDs:     make(map[uint64]struct{}),
+		//
+		initialCap:          poolConfig.InitialCap,
+		factory:             poolConfig.FactoryContext,
+		tagFactory:          poolConfig.TagFactory,
+		metaFactory:         poolConfig.FactoryMeta,
+		fallbacks:           poolConfig.Fallbacks,
+		close:               poolConfig.Close,
+		pingTimeout:         poolConfig.PingTimeout,
+		idleTimeout:         poolConfig.IdleTimeout,
+		idleTimeoutJitter:   poolConfig.IdleTimeoutJitter,
+		poolTimeout:         poolConfig.PoolTimeout,
+		idleCheckFrequency:  poolConfig.IdleCheckFrequency,
+		minIdleFrequency:    poolConfig.MinIdleCheckFrequency,
+		healthFrequency:     poolConfig.HealthCheckFrequency,
+		keepAliveFrequency:  poolConfig.KeepAliveFrequency,
+		lowWatermark:        poolConfig.LowWatermark,
+		highWatermark:       poolConfig.HighWatermark,
+		releaseCloseTimeout: poolConfig.ReleaseCloseTimeout,
+		logger:              poolConfig.Logger,
+		minPoolTimeout:      poolConfig.MinPoolTimeout,
+		maxPoolTimeout:      poolConfig.MaxPoolTimeout,
+
+		maxPingAttempts: poolConfig.MaxPingAttemptsPerGet,
+		requireCloser:   poolConfig.DefaultCloseViaIOCloser,
+		maxConnLifetime: poolConfig.MaxConnLifetime,
+		minIdle:         poolConfig.MinIdle,
+		onReuse:         poolConfig.OnReuse,
+		pingOnPut:       poolConfig.PingOnPut,
+		expiryGrace:     poolConfig.ExpiryGrace,
+		onClose:         poolConfig.OnClose,
+		addrOf:          poolConfig.AddrOf,
+		connectRetries:  poolConfig.ConnectRetries,
+		connectBackoff:  poolConfig.Backoff,
+		waitForConn:     poolConfig.WaitForConn,
+		perConnBytes:    poolConfig.PerConnBytes,
+		maxConnUses:     poolConfig.MaxConnUses,
+		retainOnPut:     poolConfig.RetainOnPut,
+		onStats:         poolConfig.OnStats,
+		onGet:           poolConfig.OnGet,
+		maxWaiters:      poolConfig.MaxWaiters,
+		wrap:            poolConfig.Wrap,
+		unwrapConn:      poolConfig.Unwrap,
+		onPut:           poolConfig.OnPut,
+		keepAlive:       poolConfig.KeepAliveFunc,
+	}
+
+	if poolConfig.MaxCreateRate > 0 {
+		burst := poolConfig.CreateBurst
+		if burst == 0 {
+			burst = 1
+		}
+		c.createLimiter = newTokenBucket(poolConfig.MaxCreateRate, burst)
+	}
+	if poolConfig.NewConnRateLimit > 0 {
+		c.createLimiter = newTokenBucket(float64(poolConfig.NewConnRateLimit), poolConfig.NewConnRateLimit)
+		c.createFailFast = true
+	}
+
+	if poolConfig.DetectReuse {
+		c.checkouts = make(map[uint64]uint64)
+	}
+
+	if poolConfig.ConnLeakThreshold > 0 {
+		c.leaks = newLeakTracker(poolConfig.ConnLeakThreshold, poolConfig.ConnLeakStack)
+	}
+
+	if poolConfig.AdaptiveTimeout {
+		c.latencies = newLatencyWindow(adaptiveWindowSize)
+	}
+
+	queue := make(chan struct{}, poolConfig.ConcurrentBase*poolConfig.MaxCap)
+	c.queue.Store(&queue)
+	c.idle.Store(idle)
+
+	if poolConfig.Ping != nil {
+		c.ping = poolConfig.Ping
+	}
+	if c.factory == nil && poolConfig.Factory != nil {
+		factory := poolConfig.Factory
+		c.factory = func(context.Context) (interface{}, error) { return factory() }
+	}
+
+	var (
+		filled  int
+		fillErr error
+	)
+	for i := 0; i < poolConfig.InitialCap; i++ {
+		// queue 容量不小于 MaxCap，这里不会阻塞
+		queue <- struct{}{}
+		conn, err := c.newConn(context.Background(), queue)
+		if err != nil {
+			if !poolConfig.AllowPartialFill {
+				c.Release()
+				return nil, fmt.Errorf("factory is not able to fill the pool: %w", err)
+			}
+			c.logger.Printf("fill: conn %d of %d not created: %s", i+1, poolConfig.InitialCap, err)
+			if fillErr == nil {
+				fillErr = err
+			}
+			continue
+		}
+		idle.push(conn)
+		filled++
+	}
+
+	c.startBackground()
+
+	if poolConfig.LazyWarmup {
+		target := poolConfig.WarmupTarget
+		if target == 0 {
+			target = poolConfig.MinIdle
+		}
+		// InitialCap 已达到目标时 n 为 0，Ready 同样关闭
+		n := target - idle.len()
+		if n < 0 {
+			n = 0
+		}
+		c.WarmupAsync(n)
+	}
+
+	if poolConfig.Context != nil {
+		go c.watchContext(poolConfig.Context)
+	}
+
+	if fillErr != nil {
+		return c, fmt.Errorf("%w: %d of %d conns created: %v", ErrPartialFill, filled, poolConfig.InitialCap, fillErr)
+	}
+	return c, nil
+}
+
+// startBackground 开始新一轮后台 goroutine，启动配置的各项后台维护
+func (c *channelPool) startBackground() {
+	c.bgMu.Lock()
+	c.bg = &background{done: make(chan struct{})}
+	c.bgMu.Unlock()
+
+	if c.lowWatermark > 0 {
+		c.goBackground(c.warmer)
+	}
+
+	if c.minIdle > 0 {
+		c.goBackground(func(done <-chan struct{}) { c.maintainMinIdle(done, c.minIdleFrequency) })
+	}
+
+	// 空闲连接处理
+	if c.idleCheckFrequency > 0 && c.idleTimeout > 0 {
+		c.goBackground(func(done <-chan struct{}) { c.reaper(done, c.idleCheckFrequency) })
+	}
+
+	if c.healthFrequency > 0 {
+		c.goBackground(func(done <-chan struct{}) { c.healthChecker(done, c.healthFrequency) })
+	}
+
+	if c.keepAlive != nil {
+		c.goBackground(func(done <-chan struct{}) { c.keepAliver(done, c.keepAliveFrequency) })
+	}
+
+	if c.leaks != nil {
+		c.goBackground(c.leakScanner)
+	}
+}
+
+// watchContext ctx 取消后关闭连接池，ClosePool 会等待后台 goroutine 退出，因此不使用 goBackground
+func (c *channelPool) watchContext(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		c.ClosePool()
+	case <-c.closedCh:
+	}
+}
+
+// 定时清理 conn
+func (c *channelPool) reaper(done <-chan struct{}, frequency time.Duration) {
+	ticker := time.NewTicker(frequency)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			c.reapStaleConns()
+		}
+	}
+}
+
+// healthChecker 定时 Ping 空闲连接，关闭失效的连接并补充到 minIdle
+func (c *channelPool) healthChecker(done <-chan struct{}, frequency time.Duration) {
+	ticker := time.NewTicker(frequency)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			c.checkIdleHealth(done)
+			if c.minIdle > 0 {
+				c.fillIdle(c.minIdle)
+			}
+		}
+	}
+}
+
+// keepAliver 定时对空闲连接调用 KeepAliveFunc
+func (c *channelPool) keepAliver(done <-chan struct{}, frequency time.Duration) {
+	ticker := time.NewTicker(frequency)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			c.exerciseIdle(done, func(wrapConn *IdleConn) error {
+				return c.keepAlive(wrapConn.conn)
+			}, ReasonKeepAliveFailed)
+		}
+	}
+}
+
+// checkIdleHealth Ping 空闲连接，关闭失效的连接
+func (c *channelPool) checkIdleHealth(done <-chan struct{}) {
+	if c.ping == nil {
+		return
+	}
+	c.exerciseIdle(done, c.Ping, ReasonPingFailed)
+}
+
+// exerciseIdle 逐个取出空闲连接调用 fn，每次只取出一个，不影响 Get 使用其余的空闲连接，fn 返回错误则以 reason 关闭
+// 成功的连接放回原来的位置且保留放回时间 t，不会因后台检查推迟空闲超时，done 关闭时提前停止
+func (c *channelPool) exerciseIdle(done <-chan struct{}, fn func(wrapConn *IdleConn) error, reason CloseReason) {
+	idle := c.getIdle()
+	if idle == nil {
+		return
+	}
+
+	for _, wrapConn := range idle.snapshot() {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		// 已被 Get 取走
+		if !idle.remove(wrapConn) {
+			continue
+		}
+		c.exerciseOne(idle, wrapConn, fn, reason)
+	}
+}
+
+// exerciseOne 对已取出的空闲连接调用 fn，成功则放回原来的位置，fn 返回错误或 panic 时以 reason 关闭
+func (c *channelPool) exerciseOne(idle *idleList, wrapConn *IdleConn, fn func(wrapConn *IdleConn) error, reason CloseReason) {
+	ok := false
+	defer func() {
+		if !ok {
+			c.discard(wrapConn, reason)
+		} else if !idle.reinsert(wrapConn) {
+			c.discard(wrapConn, ReasonPoolFull)
+		}
+	}()
+
+	ok = fn(wrapConn) == nil
+}
+
+// ReapNow 立即清理一次超过 idleTimeout 的空闲连接，返回关闭的数量，不受 IdleCheckFrequency 影响
+func (c *channelPool) ReapNow() (evicted int) {
+	return c.reapStaleConns()
+}
+
+// reapStaleConns 关闭超过 idleTimeout 的空闲连接，返回关闭的数量
+// 只取出超时的连接，关闭期间其余的空闲连接仍可被 Get 使用
+func (c *channelPool) reapStaleConns() int {
+	idle := c.getIdle()
+	if idle == nil {
+		return 0
+	}
+
+	reaped := 0
+	now := time.Now()
+	for _, wrapConn := range idle.snapshot() {
+		// 快照中的连接可能已被 Get 取走并放回，t 需持有锁读取
+		wrapConn.mu.RLock()
+		expired := c.isIdleExpired(wrapConn, now, 0)
+		wrapConn.mu.RUnlock()
+		if expired && idle.remove(wrapConn) {
+			c.discard(wrapConn, ReasonIdle)
+			reaped++
+		}
+	}
+	return reaped
+}
+
+// ForEach 对每个空闲连接调用 fn，fn 返回 false 则关闭该连接，返回关闭的数量，已取出的连接不受影响
+func (c *channelPool) ForEach(fn func(conn interface{}, lastUsed time.Time) bool) int {
+	closed := 0
+	c.forEachIdle(func(wrapConn *IdleConn) bool {
+		if fn(wrapConn.conn, wrapConn.t) {
+			return true
+		}
+		c.discard(wrapConn, ReasonUserClose)
+		closed++
+		return false
+	})
+	return closed
+}
+
+// forEachIdle 逐个取出空闲连接调用 fn，每次只取出一个，不影响 Get 使用其余的空闲连接
+// fn 返回 true 或 panic 时放回原来的位置，返回 false 时由 fn 负责处理该连接
+func (c *channelPool) forEachIdle(fn func(wrapConn *IdleConn) bool) {
+	idle := c.getIdle()
+	if idle == nil {
+		return
+	}
+
+	for _, wrapConn := range idle.snapshot() {
+		// 已被 Get 取走
+		if !idle.remove(wrapConn) {
+			continue
+		}
+		c.visitIdle(idle, wrapConn, fn)
+	}
+}
+
+// visitIdle 对已取出的空闲连接调用 fn，fn 返回 true 或 panic 时放回原来的位置
+func (c *channelPool) visitIdle(idle *idleList, wrapConn *IdleConn, fn func(wrapConn *IdleConn) bool) {
+	keep := true
+	defer func() {
+		if !keep {
+			return
+		}
+		if _, err := wrapConn.Get(); err == nil && !idle.reinsert(wrapConn) {
+			c.discard(wrapConn, ReasonPoolFull)
+		}
+	}()
+
+	keep = fn(wrapConn)
+}
+
+// SetIdleStore 更改空闲连接的取出顺序，已有的空闲连接保留
+func (c *channelPool) SetIdleStore(store IdleStore) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if idle := c.getIdle(); idle != nil {
+		idle.setFIFO(store == FIFOStore)
+	}
+}
+
+// DisableCreation 禁止新建连接，之后 Get 只使用空闲连接，没有可用的空闲连接时返回 ErrCreationDisabled
+func (c *channelPool) DisableCreation() {
+	atomic.StoreInt32(&c.creationDisabled, 1)
+}
+
+// EnableCreation 恢复新建连接
+func (c *channelPool) EnableCreation() {
+	atomic.StoreInt32(&c.creationDisabled, 0)
+}
+
+// getIdle 获取空闲连接列表，无锁读取，nil 表示连接池已关闭
+func (c *channelPool) getIdle() *idleList {
+	return c.idle.Load()
+}
+
+// generateConn 等待 queue 位置创建新连接，等待期间有空闲连接放回时直接复用
+// attempts 为已检查过的空闲连接数，达到 maxPingAttempts 后只等待 queue 位置
+// poolTimeout 为获取连接的超时时间，小于 0 表示一直等待
+func (c *channelPool) generateConn(ctx context.Context, idle *idleList, attempts int, poolTimeout time.Duration) (*IdleConn, error) {
+	// 需要等待或新建连接时才创建 timer，取到空闲连接时不产生分配
+	deadline := time.Now().Add(poolTimeout)
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	timeout := func() <-chan time.Time {
+		if poolTimeout < 0 {
+			return nil
+		}
+		if timer == nil {
+			timer = time.NewTimer(time.Until(deadline))
+		}
+		return timer.C
+	}
+
+	queue := c.getQueue()
+	var waitStart time.Time // 第一次没能立即获取 queue 位置的时间
+	for {
+		var waiter chan *IdleConn
+		if c.maxPingAttempts <= 0 || attempts < c.maxPingAttempts {
+			wrapConn, w, closed := idle.popOrWait()
+			if closed {
+				// 连接池已 Release，改为使用新的空闲连接列表和 queue
+				if idle = c.getIdle(); idle == nil || c.waitForConn {
+					return nil, ErrPoolClosed
+				}
+				queue = c.getQueue()
+				continue
+			}
+			if wrapConn != nil {
+				if c.checkIdle(wrapConn) {
+					c.recordWait(waitStart)
+					return wrapConn, nil
+				}
+				attempts++
+				continue
+			}
+			waiter = w
+		}
+
+		// 禁止新建连接时只使用空闲连接
+		if atomic.LoadInt32(&c.creationDisabled) == 1 {
+			c.leaveWait(idle, waiter)
+			return nil, ErrCreationDisabled
+		}
+
+		select {
+		case queue <- struct{}{}:
+			c.leaveWait(idle, waiter)
+			c.recordWait(waitStart)
+			return c.newFreshConn(ctx, queue, timeout())
+		default:
+		}
+		if waitStart.IsZero() {
+			if c.maxWaiters > 0 {
+				if atomic.AddInt32(&c.waiting, 1) > int32(c.maxWaiters) {
+					atomic.AddInt32(&c.waiting, -1)
+					c.leaveWait(idle, waiter)
+					return nil, ErrTooManyWaiters
+				}
+				defer atomic.AddInt32(&c.waiting, -1)
+			}
+			waitStart = time.Now()
+		}
+
+		select {
+		case queue <- struct{}{}:
+			c.leaveWait(idle, waiter)
+			c.recordWait(waitStart)
+			return c.newFreshConn(ctx, queue, timeout())
+		case wrapConn, ok := <-waiter:
+			// 放回的连接直接交给等待的 Get，waiter 关闭表示连接池已 Release
+			if !ok {
+				continue
+			}
+			if c.checkIdle(wrapConn) {
+				c.recordWait(waitStart)
+				return wrapConn, nil
+			}
+			attempts++
+		case <-timeout():
+			c.leaveWait(idle, waiter)
+			atomic.AddUint64(&c.timeouts, 1)
+			return nil, ErrPoolTimeout
+		case <-ctx.Done():
+			c.leaveWait(idle, waiter)
+			return nil, ctxError(ctx.Err())
+		}
+	}
+}
+
+// leaveWait 不再等待放回的连接，取消前已交付的连接重新放回
+func (c *channelPool) leaveWait(idle *idleList, waiter chan *IdleConn) {
+	if waiter == nil || idle.cancelWait(waiter) {
+		return
+	}
+	if wrapConn, ok := <-waiter; ok && !idle.push(wrapConn) {
+		c.discard(wrapConn, ReasonPoolFull)
+	}
+}
+
+// newFreshConn 已占用 queue 位置后为 Get 创建连接，ctx 已取消时关闭新建的连接
+// 设置了 MaxCreateRate 时先等待令牌，timeout 或 ctx 先到则释放位置
+func (c *channelPool) newFreshConn(ctx context.Context, queue chan struct{}, timeout <-chan time.Time) (*IdleConn, error) {
+	if err := c.waitCreateToken(ctx, timeout); err != nil {
+		c.freeTurn(queue)
+		return nil, err
+	}
+
+	wrapConn, err := c.newConn(ctx, queue)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxError(ctxErr)
+		}
+		return nil, err
+	}
+	// factory 返回前 ctx 已取消，关闭新建的连接并释放位置
+	if err := ctx.Err(); err != nil {
+		c.discard(wrapConn, ReasonUserClose)
+		return nil, ctxError(err)
+	}
+	if err := c.runOnGet(wrapConn); err != nil {
+		return nil, err
+	}
+	wrapConn.fresh = true
+	return wrapConn, nil
+}
+
+// waitCreateToken 等待新建连接的令牌，NewConnRateLimit 时不等待，没有令牌则返回 ErrRateLimited
+func (c *channelPool) waitCreateToken(ctx context.Context, timeout <-chan time.Time) error {
+	if c.createLimiter == nil {
+		return nil
+	}
+	if c.createFailFast {
+		if !c.createLimiter.tryTake() {
+			return ErrRateLimited
+		}
+		return nil
+	}
+	d := c.createLimiter.reserve()
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-timeout:
+		c.createLimiter.cancel()
+		atomic.AddUint64(&c.timeouts, 1)
+		return ErrPoolTimeout
+	case <-ctx.Done():
+		c.createLimiter.cancel()
+		return ctxError(ctx.Err())
+	}
+}
+
+// recordWait 记录 Get 阻塞等待的次数和时间，waitStart 为零值表示没有等待
+func (c *channelPool) recordWait(waitStart time.Time) {
+	if waitStart.IsZero() {
+		return
+	}
+	atomic.AddUint32(&c.waitCount, 1)
+	atomic.AddInt64(&c.waitDuration, int64(time.Since(waitStart)))
+}
+
+// ctxError 包装 ctx 取消或超时的错误，可通过 errors.Is 判断
+func ctxError(err error) error {
+	return fmt.Errorf("get conn: %w", err)
+}
+
+// closeViaIOCloser DefaultCloseViaIOCloser 时使用的关闭方法
+func closeViaIOCloser(conn interface{}) error {
+	closer, ok := conn.(io.Closer)
+	if !ok {
+		return fmt.Errorf("%w: %T", ErrConnNotCloser, conn)
+	}
+	return closer.Close()
+}
+
+// dialed factory 生成的连接及其标签和元数据
+type dialed struct {
+	conn interface{}
+	tag  string
+	meta map[string]interface{}
+}
+
+// dial 调用 factory 生成连接，失败时依次尝试 fallbacks，全部失败时返回最后一个错误
+func (c *channelPool) dial(ctx context.Context) (d dialed, err error) {
+	switch {
+	case c.metaFactory != nil:
+		d.conn, d.meta, err = c.metaFactory()
+	case c.tagFactory != nil:
+		d.conn, d.tag, err = c.tagFactory()
+	default:
+		d.conn, err = c.factory(ctx)
+	}
+	for i := 0; err != nil && i < len(c.fallbacks); i++ {
+		var conn interface{}
+		if conn, err = c.fallbacks[i](); err == nil {
+			d = dialed{conn: conn, meta: map[string]interface{}{"fallback": i}}
+		}
+	}
+	return d, err
+}
+
+// dialRetry 调用 dial，失败时按 connectBackoff 的间隔重试 connectRetries 次，连接池 Release、关闭或 ctx 取消时停止重试
+func (c *channelPool) dialRetry(ctx context.Context) (dialed, error) {
+	idle := c.getIdle()
+	for attempt := 0; ; attempt++ {
+		d, err := c.dial(ctx)
+		if err == nil || attempt >= c.connectRetries || idle == nil || ctx.Err() != nil {
+			return d, err
+		}
+
+		timer := time.NewTimer(c.connectBackoff.NextBackoff(attempt))
+		select {
+		case <-timer.C:
+		case <-idle.done:
+			timer.Stop()
+			return dialed{}, err
+		case <-ctx.Done():
+			timer.Stop()
+			return dialed{}, err
+		}
+	}
+}
+
+// newConn 已占用 queue 位置后创建连接，失败或 Factory panic 时释放位置
+func (c *channelPool) newConn(ctx context.Context, queue chan struct{}) (*IdleConn, error) {
+	created := false
+	defer func() {
+		if !created {
+			c.freeTurn(queue)
+		}
+	}()
+
+	if atomic.LoadInt32(&c.quiesced) == 1 {
+		return nil, ErrPoolClosed
+	}
+	if atomic.LoadInt32(&c.creationDisabled) == 1 {
+		return nil, ErrCreationDisabled
+	}
+
+	wrapConn, err := c.wrapDialed(ctx)
+	if err != nil {
+		return nil, err
+	}
+	created = true
+	if len(queue) > c.initialCap {
+		atomic.AddUint64(&c.growthEvents, 1)
+	}
+	wrapConn.id = atomic.AddUint64(&c.lastID, 1)
+	wrapConn.queue = queue
+	c.trackID(wrapConn.id)
+	return wrapConn, nil
+}
+
+// wrapDialed 生成连接并包装为 IdleConn，不分配 id 和 queue 位置
+func (c *channelPool) wrapDialed(ctx context.Context) (*IdleConn, error) {
+	// 生成期间 InvalidateAll 的连接同样失效
+	generation := c.Generation()
+	d, err := c.dialRetry(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrConnGenerateFailed, err)
+	}
+	if c.requireCloser {
+		if _, ok := d.conn.(io.Closer); !ok {
+			return nil, fmt.Errorf("%w: %T", ErrConnNotCloser, d.conn)
+		}
+	}
+	wrapConn := NewIdleConn(d.conn, time.Now(), c)
+	wrapConn.tag = d.tag
+	wrapConn.meta = d.meta
+	wrapConn.generation = generation
+	wrapConn.idleTimeout = c.idleTimeout
+	if c.idleTimeoutJitter > 0 {
+		wrapConn.idleTimeout += time.Duration(rand.Int63n(int64(c.idleTimeoutJitter)))
+	}
+	if c.addrOf != nil {
+		wrapConn.addr = c.addrOf(d.conn)
+	}
+	return wrapConn, nil
+}
+
+// redial 为 IdleConn.Reset 新建连接，沿用原连接的 queue 位置，与 newConn 一样受连接池状态和新建速率限制
+func (c *channelPool) redial() (*IdleConn, error) {
+	if c.getIdle() == nil || atomic.LoadInt32(&c.quiesced) == 1 {
+		return nil, ErrPoolClosed
+	}
+	if atomic.LoadInt32(&c.creationDisabled) == 1 {
+		return nil, ErrCreationDisabled
+	}
+	timeout := time.NewTimer(c.currentPoolTimeout())
+	defer timeout.Stop()
+	if err := c.waitCreateToken(context.Background(), timeout.C); err != nil {
+		return nil, err
+	}
+
+	wrapConn, err := c.wrapDialed(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if c.wrap != nil {
+		if wrapConn.wrapped, err = c.wrap(wrapConn.conn); err != nil {
+			c.closeReplaced(wrapConn.conn, ReasonHookFailed)
+			return nil, err
+		}
+	}
+	return wrapConn, nil
+}
+
+// closeReplaced 关闭不占用 queue 位置的连接，如 Reset 替换下来的连接，不能经过 discard
+func (c *channelPool) closeReplaced(conn interface{}, reason CloseReason) {
+	c.close(conn)
+	c.notifyClose(conn, reason)
+}
+
+// freeTurn 释放 queue 位置，queue 为 nil 时使用当前的 queue
+func (c *channelPool) freeTurn(queue chan struct{}) {
+	if queue == nil {
+		queue = c.getQueue()
+	}
+	<-queue
+}
+
+// getQueue 获取当前的 queue，无锁读取
+func (c *channelPool) getQueue() chan struct{} {
+	return *c.queue.Load()
+}
+
+// putIdle 将连接放入空闲队列，队列已满或连接池已关闭时返回 false
+func (c *channelPool) putIdle(wrapConn *IdleConn) bool {
+	idle := c.getIdle()
+	if idle == nil {
+		return false
+	}
+	return idle.push(wrapConn)
+}
+
+// notifyWarmer 空闲连接低于 lowWatermark 时通知后台补充
+func (c *channelPool) notifyWarmer() {
+	if c.lowWatermark <= 0 || c.Len() >= c.lowWatermark {
+		return
+	}
+	select {
+	case c.warmCh <- struct{}{}:
+	default:
+	}
+}
+
+// warmer 后台补充空闲连接到 highWatermark，避免在 lowWatermark 附近反复创建
+func (c *channelPool) warmer(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-c.warmCh:
+			c.fillIdle(c.highWatermark)
+		}
+	}
+}
+
+// maintainMinIdle 定时补充空闲连接到 minIdle
+func (c *channelPool) maintainMinIdle(done <-chan struct{}, frequency time.Duration) {
+	ticker := time.NewTicker(frequency)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			c.fillIdle(c.minIdle)
+		}
+	}
+}
+
+// fillIdle 补充空闲连接到 n 个，不等待 queue 位置，创建失败即停止
+func (c *channelPool) fillIdle(n int) {
+	for c.Len() < n {
+		if ok, err := c.addIdle(); !ok || err != nil {
+			return
+		}
+	}
+}
+
+// Warmup 新建最多 n 个连接放入空闲队列，queue 或空闲队列已满时提前停止，返回遇到的第一个错误
+func (c *channelPool) Warmup(n int) error {
+	var created int
+	return c.warmup(n, &created, nil)
+}
+
+// WarmupAsync 在后台执行 Warmup，新建了 n 个连接或 queue、空闲队列已满时关闭 Ready 返回的 channel
+// 生成连接失败或被 Release 中断时输出到 Logger，Ready 不关闭
+func (c *channelPool) WarmupAsync(n int) {
+	// panic 后重新运行时只补充剩余的数量
+	var created int
+	c.goBackground(func(done <-chan struct{}) {
+		err := c.warmup(n, &created, done)
+		if err != nil {
+			c.logger.Printf("warmup: %d of %d conns created: %s", created, n, err)
+			return
+		}
+		if created < n {
+			select {
+			case <-done:
+				c.logger.Printf("warmup: %d of %d conns created: stopped by release", created, n)
+				return
+			default:
+			}
+			// 连接池已满，无法再补充
+			c.logger.Printf("warmup: %d of %d conns created: pool is full", created, n)
+		}
+		c.readyOnce.Do(func() {
+			close(c.readyCh)
+		})
+	})
+}
+
+// Ready WarmupAsync 第一次完成时关闭
+func (c *channelPool) Ready() <-chan struct{} {
+	return c.readyCh
+}
+
+// warmup 新建空闲连接直到 created 达到 n，每新建一个 created 加 1，stop 关闭时提前停止
+func (c *channelPool) warmup(n int, created *int, stop <-chan struct{}) error {
+	for *created < n {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		if ok, err := c.addIdle(); !ok || err != nil {
+			return err
+		}
+		*created++
+	}
+	return nil
+}
+
+// addIdle 不等待 queue 位置新建一个连接放入空闲队列，queue 或空闲队列已满时返回 false
+func (c *channelPool) addIdle() (bool, error) {
+	if c.getIdle() == nil {
+		return false, ErrPoolClosed
+	}
+
+	queue := c.getQueue()
+	select {
+	case queue <- struct{}{}:
+	default:
+		return false, nil
+	}
+	if c.createLimiter != nil && !c.createLimiter.tryTake() {
+		c.freeTurn(queue)
+		return false, nil
+	}
+
+	wrapConn, err := c.newConn(context.Background(), queue)
+	if err != nil {
+		return false, err
+	}
+	if !c.putIdle(wrapConn) {
+		c.discard(wrapConn, ReasonPoolFull)
+		return false, nil
+	}
+	return true, nil
+}
+
+// background 一轮后台 goroutine，done 关闭后退出，Release 时结束并开始新的一轮
+type background struct {
+	done    chan struct{}
+	wg      sync.WaitGroup
+	stopped bool // done 已关闭，需持有 bgMu
+}
+
+// stoppedBackground startBackground 之前的后台状态，goBackground 不启动 goroutine
+func stoppedBackground() *background {
+	bg := &background{done: make(chan struct{}), stopped: true}
+	close(bg.done)
+	return bg
+}
+
+// goBackground 启动后台 goroutine，stopBackground 会等待其退出
+// fn panic 时记录日志，间隔一段时间后重新运行
+func (c *channelPool) goBackground(fn func(done <-chan struct{})) {
+	c.bgMu.Lock()
+	bg := c.bg
+	if bg.stopped {
+		c.bgMu.Unlock()
+		return
+	}
+	bg.wg.Add(1)
+	c.bgMu.Unlock()
+
+	go func() {
+		defer bg.wg.Done()
+
+		backoff := &ExponentialBackoff{Base: restartBackoffBase, Max: restartBackoffMax}
+		for attempt := 0; c.runRecovered(func() { fn(bg.done) }); attempt++ {
+			timer := time.NewTimer(backoff.NextBackoff(attempt))
+			select {
+			case <-timer.C:
+			case <-bg.done:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// runRecovered 运行 fn，发生 panic 时记录日志并返回 true
+func (c *channelPool) runRecovered(fn func()) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.logger.Printf("background goroutine panic: %v", r)
+			panicked = true
+		}
+	}()
+	fn()
+	return false
+}
+
+// stopBackground 通知后台 goroutine 退出并等待退出完成，之后才能关闭连接，返回此前是否在运行
+func (c *channelPool) stopBackground() (running bool) {
+	c.bgMu.Lock()
+	bg := c.bg
+	if !bg.stopped {
+		bg.stopped = true
+		close(bg.done)
+		running = true
+	}
+	c.bgMu.Unlock()
+
+	bg.wg.Wait()
+	return running
+}
+
+// Get 从 pool 中取一个连接
+func (c *channelPool) Get() (*IdleConn, error) {
+	return c.GetContext(context.Background())
+}
+
+// GetTimeout 以 d 代替 PoolTimeout 获取连接，d 为 0 时同 TryGet，小于 0 时同 Get
+func (c *channelPool) GetTimeout(d time.Duration) (*IdleConn, error) {
+	if d == 0 {
+		return c.TryGet()
+	}
+	if d < 0 {
+		return c.Get()
+	}
+
+	start := time.Now()
+	wrapConn, err := c.getTimeout(context.Background(), d)
+	if err != nil {
+		return nil, err
+	}
+	c.handOut(context.Background(), wrapConn, time.Since(start))
+	return wrapConn, nil
+}
+
+// GetRaw 取一个连接并返回底层连接，release 将连接放回 pool
+func (c *channelPool) GetRaw() (interface{}, func() error, error) {
+	wrapConn, err := c.Get()
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := wrapConn.Get()
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, func() error { return c.Put(wrapConn) }, nil
+}
+
+// GetContext 从 pool 中取一个连接，ctx 取消或超时则返回包装后的 ctx.Err()
+// ctx 经 WithAcquireInfo 包装时记录本次获取的 AcquireInfo
+func (c *channelPool) GetContext(ctx context.Context) (*IdleConn, error) {
+	start := time.Now()
+	wrapConn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.handOut(ctx, wrapConn, time.Since(start))
+	return wrapConn, nil
+}
+
+// GetValidated 获取通过 validate 检查的连接，未通过的连接直接关闭，
+// 直到取得通过检查的连接、ctx 取消或超过 PoolTimeout
+func (c *channelPool) GetValidated(ctx context.Context, validate func(conn interface{}) bool) (*IdleConn, error) {
+	start := time.Now()
+	deadline := start.Add(c.currentPoolTimeout())
+	for {
+		wrapConn, err := c.get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if conn, err := wrapConn.Get(); err == nil && validate(conn) {
+			c.handOut(ctx, wrapConn, time.Since(start))
+			return wrapConn, nil
+		}
+		c.discard(wrapConn, ReasonValidateFailed)
+
+		if time.Now().After(deadline) {
+			atomic.AddUint64(&c.timeouts, 1)
+			return nil, ErrPoolTimeout
+		}
+	}
+}
+
+// BatchGet 依次 Get n 个连接，每个连接各自受 PoolTimeout 限制
+// 任意一次失败时已取得的连接全部放回，不会泄漏
+func (c *channelPool) BatchGet(n int) ([]*IdleConn, error) {
+	conns := make([]*IdleConn, 0, n)
+	for i := 0; i < n; i++ {
+		wrapConn, err := c.Get()
+		if err != nil {
+			for _, acquired := range conns {
+				c.Put(acquired)
+			}
+			return nil, err
+		}
+		conns = append(conns, wrapConn)
+	}
+	return conns, nil
+}
+
+// GetMultiContext 依次 GetContext 最多 n 个连接，与 BatchGet 不同，失败时不放回已取得的连接，
+// 而是连同错误一起返回，ctx 取消或超时时 err 包装 ctx.Err()。
+// 返回的连接无论 err 是否为 nil 都归调用方所有，需由调用方逐个放回
+func (c *channelPool) GetMultiContext(ctx context.Context, n int) ([]*IdleConn, error) {
+	conns := make([]*IdleConn, 0, n)
+	for i := 0; i < n; i++ {
+		wrapConn, err := c.GetContext(ctx)
+		if err != nil {
+			return conns, err
+		}
+		conns = append(conns, wrapConn)
+	}
+	return conns, nil
+}
+
+// TryGet 不等待 queue 位置的 Get，没有可用的空闲连接且 queue 已满时立即返回 ErrPoolTimeout
+func (c *channelPool) TryGet() (*IdleConn, error) {
+	start := time.Now()
+	idle := c.getIdle()
+	if idle == nil || atomic.LoadInt32(&c.quiesced) == 1 {
+		return nil, ErrPoolClosed
+	}
+	defer c.notifyWarmer()
+
+	for wrapConn := idle.pop(); wrapConn != nil; wrapConn = idle.pop() {
+		if c.checkIdle(wrapConn) {
+			c.handOut(context.Background(), wrapConn, time.Since(start))
+			return wrapConn, nil
+		}
+	}
+
+	queue := c.getQueue()
+	select {
+	case queue <- struct{}{}:
+	default:
+		atomic.AddUint64(&c.timeouts, 1)
+		return nil, ErrPoolTimeout
+	}
+	if c.createLimiter != nil && !c.createLimiter.tryTake() {
+		c.freeTurn(queue)
+		if c.createFailFast {
+			return nil, ErrRateLimited
+		}
+		atomic.AddUint64(&c.timeouts, 1)
+		return nil, ErrPoolTimeout
+	}
 
-	factory            func() (interface{}, error)
-	close              func(interface{}) error
-	ping               func(interface{}) error
-	idleTimeout        time.Duration
-	poolTimeout        time.Duration
-	idleCheckFrequency time.Duration
+	wrapConn, err := c.newConn(context.Background(), queue)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.runOnGet(wrapConn); err != nil {
+		return nil, err
+	}
+	wrapConn.fresh = true
+	c.handOut(context.Background(), wrapConn, time.Since(start))
+	return wrapConn, nil
 }
 
-// NewChannelPool 初始化连接
-func NewChannelPool(poolConfig *Config) (Pool, error) {
-	if poolConfig.InitialCap < 0 || poolConfig.MaxCap <= 0 || poolConfig.InitialCap > poolConfig.MaxCap {
-		return nil, errors.New("invalid capacity settings")
+// GetAffinity 优先取最近一次以相同 key 取出的空闲连接，没有时同 Get，取出的连接记录 key
+func (c *channelPool) GetAffinity(key string) (*IdleConn, error) {
+	start := time.Now()
+	idle := c.getIdle()
+	if idle == nil || atomic.LoadInt32(&c.quiesced) == 1 {
+		return nil, ErrPoolClosed
 	}
-	if poolConfig.Factory == nil {
-		return nil, errors.New("invalid factory func settings")
+
+	match := func(wrapConn *IdleConn) bool { return wrapConn.affinity == key }
+	for wrapConn := idle.popMatch(match); wrapConn != nil; wrapConn = idle.popMatch(match) {
+		if c.checkIdle(wrapConn) {
+			c.notifyWarmer()
+			c.handOut(context.Background(), wrapConn, time.Since(start))
+			wrapConn.affinity = key
+			return wrapConn, nil
+		}
 	}
-	if poolConfig.Close == nil {
-		return nil, errors.New("invalid close func settings")
+
+	wrapConn, err := c.get(context.Background())
+	if err != nil {
+		return nil, err
 	}
+	c.handOut(context.Background(), wrapConn, time.Since(start))
+	// handOut 清除了上一次的 key
+	wrapConn.affinity = key
+	return wrapConn, nil
+}
 
-	if poolConfig.PoolTimeout <= 0 {
-		poolConfig.PoolTimeout = PoolTimeoutInit
+// handOut 连接交给调用方前记录耗时并调用相关回调
+func (c *channelPool) handOut(ctx context.Context, wrapConn *IdleConn, elapsed time.Duration) {
+	if c.latencies != nil {
+		c.latencies.record(elapsed)
+	}
+	wrapConn.mu.Lock()
+	wrapConn.uses++
+	wrapConn.mu.Unlock()
+	// 不经 GetAffinity 取出的连接不再属于之前的 key
+	wrapConn.affinity = ""
+	if c.checkouts != nil {
+		c.checkOut(wrapConn)
+	}
+	if c.leaks != nil {
+		c.leaks.track(wrapConn)
 	}
+	if wrapConn.fresh {
+		atomic.AddUint64(&c.misses, 1)
+	} else {
+		atomic.AddUint64(&c.hits, 1)
+	}
+	setAcquireInfo(ctx, AcquireInfo{
+		Duration: elapsed,
+		Fresh:    wrapConn.fresh,
+	})
+	if !wrapConn.fresh && c.onReuse != nil {
+		c.onReuse(wrapConn.conn, time.Since(wrapConn.t))
+	}
+}
 
-	if poolConfig.IdleCheckFrequency == 0 {
-		poolConfig.IdleCheckFrequency = IdleCheckInit
+func (c *channelPool) get(ctx context.Context) (*IdleConn, error) {
+	// WaitForConn 时一直等待，直到有可用的连接或连接池 Release、关闭
+	poolTimeout := c.currentPoolTimeout()
+	if c.waitForConn {
+		poolTimeout = -1
 	}
+	return c.getTimeout(ctx, poolTimeout)
+}
 
-	if poolConfig.ConcurrentBase <= 0 {
-		poolConfig.ConcurrentBase = 2
+// getTimeout 以 poolTimeout 为超时时间获取连接，小于 0 表示一直等待
+func (c *channelPool) getTimeout(ctx context.Context, poolTimeout time.Duration) (*IdleConn, error) {
+	idle := c.getIdle()
+	if idle == nil || atomic.LoadInt32(&c.quiesced) == 1 {
+		return nil, ErrPoolClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, ctxError(err)
 	}
+	defer c.notifyWarmer()
 
-	c := &channelPool{
-		initTime: time.Now(),
-		conns:    make(chan *IdleConn, poolConfig.MaxCap),
-		queue:    make(chan struct{}, poolConfig.ConcurrentBase*poolConfig.MaxCap),
-		//
-		factory:            poolConfig.Factory,
-		close:              poolConfig.Close,
-		idleTimeout:        poolConfig.IdleTimeout,
-		poolTimeout:        poolConfig.PoolTimeout,
-		idleCheckFrequency: poolConfig.IdleCheckFrequency,
+	return c.generateConn(ctx, idle, 0, poolTimeout)
+}
+
+// checkIdle 检查取出的空闲连接是否可用，不可用则关闭
+func (c *channelPool) checkIdle(wrapConn *IdleConn) bool {
+	if _, err := wrapConn.Get(); err != nil {
+		return false
 	}
 
-	if poolConfig.Ping != nil {
-		c.ping = poolConfig.Ping
+	if wrapConn.generation != c.Generation() {
+		c.discard(wrapConn, ReasonInvalidated)
+		return false
+	}
+	//判断是否超时，超时则丢弃
+	if c.isIdleExpired(wrapConn, time.Now(), c.expiryGrace) {
+		//丢弃并关闭该连接
+		c.discard(wrapConn, ReasonIdle)
+		return false
+	}
+	if err := c.Ping(wrapConn); err != nil {
+		c.discard(wrapConn, ReasonPingFailed)
+		return false
+	}
+	//超过最大存活时间则丢弃
+	if c.maxConnLifetime > 0 && wrapConn.createdAt.Add(c.maxConnLifetime).Before(time.Now()) {
+		c.discard(wrapConn, ReasonMaxLifetime)
+		return false
 	}
+	return c.runOnGet(wrapConn) == nil
+}
 
-	for i := 0; i < poolConfig.InitialCap; i++ {
-		conn, err := c.generateConn()
+// runOnGet 调用 OnGet 并用 Wrap 包装连接，返回错误时关闭连接
+func (c *channelPool) runOnGet(wrapConn *IdleConn) error {
+	if c.onGet != nil {
+		if err := c.onGet(wrapConn.conn); err != nil {
+			c.discard(wrapConn, ReasonHookFailed)
+			return err
+		}
+	}
+	if c.wrap != nil {
+		wrapped, err := c.wrap(wrapConn.conn)
 		if err != nil {
-			c.Release()
-			return nil, fmt.Errorf("factory is not able to fill the pool: %s", err)
+			c.discard(wrapConn, ReasonHookFailed)
+			return err
 		}
-		c.conns <- conn
+		wrapConn.mu.Lock()
+		wrapConn.wrapped = wrapped
+		wrapConn.mu.Unlock()
 	}
+	return nil
+}
 
-	// 空闲连接处理
-	//if c.idleCheckFrequency > 0 && c.idleTimeout > 0 {
-	//	go c.reaper(c.idleCheckFrequency)
-	//}
+// unwrap 用 Unwrap 取回 Wrap 包装前的连接作为放回的连接
+func (c *channelPool) unwrap(wrapConn *IdleConn) error {
+	wrapConn.mu.Lock()
+	defer wrapConn.mu.Unlock()
 
-	return c, nil
+	if wrapConn.wrapped == nil {
+		return nil
+	}
+	if c.unwrapConn != nil {
+		conn, err := c.unwrapConn(wrapConn.wrapped)
+		if err != nil {
+			return err
+		}
+		wrapConn.conn = conn
+	}
+	wrapConn.wrapped = nil
+	return nil
 }
 
-// 定时清理 conn
-//func (c *channelPool) reaper(frequency time.Duration) {
-//	ticker := time.NewTicker(frequency)
-//	defer ticker.Stop()
-//
-//	for range ticker.C {
-//		conns := c.getConns()
-//		if conns == nil {
-//			break
-//		}
-//		//c.reapStaleConns(conns)
-//	}
-//}
-
-// getConns 获取所有连接
-func (c *channelPool) getConns() chan *IdleConn {
+// isIdleExpired 判断空闲连接是否超过其空闲超时时间，距离超时不足 grace 也算超时，keepWarmUntil 之前不算超时
+func (c *channelPool) isIdleExpired(wrapConn *IdleConn, now time.Time, grace time.Duration) bool {
+	if c.idleTimeout <= 0 || now.Before(wrapConn.keepWarmUntil) {
+		return false
+	}
+	idleTimeout := wrapConn.idleTimeout
+	if idleTimeout == 0 {
+		idleTimeout = c.idleTimeout
+	}
+	return wrapConn.t.Add(idleTimeout - grace).Before(now)
+}
+
+// Put 将连接放回 pool 中
+func (c *channelPool) Put(wrapConn *IdleConn) error {
+	return c.put(wrapConn, time.Time{})
+}
+
+// Generation 连接池的代数，每次 Release 或 InvalidateAll 加 1，之前生成的连接放回时直接关闭
+func (c *channelPool) Generation() uint64 {
+	return atomic.LoadUint64(&c.generation)
+}
+
+// InvalidateAll 使现有的连接全部失效，空闲连接在 Get 取出时关闭并新建，已取出的连接放回时关闭
+// 与 Release 不同，不会立即关闭空闲连接，也不会重新分配 channel
+func (c *channelPool) InvalidateAll() {
+	atomic.AddUint64(&c.generation, 1)
+}
+
+// stale 连接是否属于 Release 或 InvalidateAll 之前的连接池
+func (c *channelPool) stale(wrapConn *IdleConn) bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
+	return c.releasedLocked(wrapConn) || wrapConn.generation != c.Generation()
+}
 
-	return c.conns
+// releasedLocked 连接是否属于 Release 之前的连接池，需持有 mu
+// 创建期间发生 Release 的连接 t 可能晚于 initTime，需要比较 queue
+func (c *channelPool) releasedLocked(wrapConn *IdleConn) bool {
+	return wrapConn.t.Before(c.initTime) || (wrapConn.queue != nil && wrapConn.queue != c.getQueue())
 }
 
-func (c *channelPool) generateConn() (*IdleConn, error) {
-	select {
-	case c.queue <- struct{}{}:
-		// get
-	case <-time.After(c.poolTimeout):
-		return nil, ErrPoolTimeout
+// PutErr 根据使用连接时的错误放回连接，err 不为 nil 说明连接已损坏，关闭而不放回
+func (c *channelPool) PutErr(wrapConn *IdleConn, err error) error {
+	if err == nil {
+		return c.Put(wrapConn)
 	}
-
-	conn, err := c.factory()
-	if err != nil {
-		c.freeTurn()
-		return nil, ErrConnGenerateFailed
+	if wrapConn == nil {
+		return nil
 	}
-	return NewIdleConn(conn, time.Now(), c), nil
+	return c.discard(wrapConn, ReasonBroken)
 }
 
-func (c *channelPool) freeTurn() {
-	<-c.queue
+// PutKeepWarm 将连接放回 pool 中，d 时间内不会因 idleTimeout 被丢弃
+func (c *channelPool) PutKeepWarm(wrapConn *IdleConn, d time.Duration) error {
+	return c.put(wrapConn, time.Now().Add(d))
 }
 
-// Get 从 pool 中取一个连接
-func (c *channelPool) Get() (*IdleConn, error) {
-	conns := c.getConns()
-	if conns == nil {
-		return nil, ErrPoolClosed
+func (c *channelPool) put(wrapConn *IdleConn, keepWarmUntil time.Time) error {
+	if wrapConn == nil {
+		return nil
 	}
 
-	select {
-	case wrapConn := <-conns:
-		if wrapConn.conn != nil {
-			//判断是否超时，超时则丢弃
-			if idleTimeout := c.idleTimeout; idleTimeout > 0 && wrapConn.t.Add(idleTimeout).Before(time.Now()) {
-				//丢弃并关闭该连接
-				c.Close(wrapConn)
-				wrapConn.conn = nil
-			} else if err := c.Ping(wrapConn); err != nil {
-				c.Close(wrapConn)
-				wrapConn.conn = nil
+	// 连接已放回或关闭，底层连接可能已被新的 IdleConn 放回 pool
+	if _, err := wrapConn.Get(); err != nil {
+		atomic.AddUint64(&c.doublePuts, 1)
+		return err
+	}
+
+	if c.checkouts != nil && !c.checkIn(wrapConn) {
+		return ErrConnReused
+	}
+	if c.leaks != nil {
+		c.leaks.untrack(wrapConn)
+	}
+
+	if err := c.unwrap(wrapConn); err != nil {
+		return c.discard(wrapConn, ReasonHookFailed)
+	}
+
+	// OnClose 可能重入连接池，关闭连接时不能持有 mu
+	c.mu.RLock()
+	idle := c.getIdle()
+	released := c.releasedLocked(wrapConn)
+	c.mu.RUnlock()
+
+	if idle == nil || atomic.LoadInt32(&c.quiesced) == 1 || released {
+		return c.discard(wrapConn, ReasonRelease)
+	}
+	if wrapConn.generation != c.Generation() {
+		return c.discard(wrapConn, ReasonInvalidated)
+	}
+
+	// 连接池已关闭或 Release 时直接关闭，不再替换
+	if c.takeRecreateMark(wrapConn.id) {
+		_, err := c.recreate(wrapConn)
+		return err
+	}
+
+	//放回前检查连接，失效则直接关闭
+	if c.pingOnPut {
+		if err := c.Ping(wrapConn); err != nil {
+			if err == ErrConnClosed {
+				return err
 			}
+			return c.discard(wrapConn, ReasonPingFailed)
 		}
+	}
+
+	//达到最大使用次数则关闭
+	if c.maxConnUses > 0 && wrapConn.uses >= c.maxConnUses {
+		return c.discard(wrapConn, ReasonMaxUses)
+	}
 
-		if wrapConn.conn == nil {
-			return c.generateConn()
+	if c.retainOnPut != nil {
+		wrapConn.mu.RLock()
+		conn, lastErr := wrapConn.conn, wrapConn.lastErr
+		wrapConn.mu.RUnlock()
+		if !c.retainOnPut(conn, time.Since(wrapConn.createdAt), wrapConn.uses, lastErr) {
+			return c.discard(wrapConn, ReasonNotRetained)
 		}
+	}
 
-		return wrapConn, nil
-	default:
-		return c.generateConn()
+	if c.onPut != nil {
+		if err := c.onPut(wrapConn.conn); err != nil {
+			return c.discard(wrapConn, ReasonHookFailed)
+		}
 	}
+
+	conn, err := wrapConn.take()
+	if err != nil {
+		return err
+	}
+
+	idleConn := NewIdleConn(conn, time.Now(), c)
+	idleConn.id = wrapConn.id
+	idleConn.createdAt = wrapConn.createdAt
+	idleConn.tag = wrapConn.tag
+	idleConn.addr = wrapConn.addr
+	idleConn.affinity = wrapConn.affinity
+	idleConn.meta = wrapConn.meta
+	idleConn.idleTimeout = wrapConn.idleTimeout
+	idleConn.queue = wrapConn.queue
+	idleConn.generation = wrapConn.generation
+	idleConn.uses = wrapConn.uses
+	idleConn.keepWarmUntil = keepWarmUntil
+
+	if !idle.push(idleConn) {
+		//连接池已满，直接关闭该连接，wrapConn 已失效，需要关闭新的 idleConn 才能释放位置
+		c.discard(idleConn, ReasonPoolFull)
+	}
+	return nil
 }
 
-// Put 将连接放回 pool 中
-func (c *channelPool) Put(wrapConn *IdleConn) error {
-	if wrapConn == nil {
-		return nil
+// RecreateByID 关闭指定 id 的空闲连接并新建一条连接代替，返回新连接的 id
+// 该连接已被取出时标记为放回时替换，返回 0；没有该 id 的存活连接时返回 ErrConnClosed
+func (c *channelPool) RecreateByID(id uint64) (uint64, error) {
+	idle := c.getIdle()
+	if idle == nil {
+		return 0, ErrPoolClosed
+	}
+	for _, wrapConn := range idle.snapshot() {
+		// 已被 Get 取走时按已取出的连接处理
+		if wrapConn.id == id && idle.remove(wrapConn) {
+			return c.recreate(wrapConn)
+		}
 	}
 
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	c.recreateMu.Lock()
+	defer c.recreateMu.Unlock()
+	if _, ok := c.liveIDs[id]; !ok {
+		return 0, ErrConnClosed
+	}
+	c.recreateIDs[id] = struct{}{}
+	return 0, nil
+}
+
+// trackID 记录新建连接的 id
+func (c *channelPool) trackID(id uint64) {
+	c.recreateMu.Lock()
+	c.liveIDs[id] = struct{}{}
+	c.recreateMu.Unlock()
+}
+
+// untrackID 连接关闭后清除其 id 及替换标记
+func (c *channelPool) untrackID(id uint64) {
+	c.recreateMu.Lock()
+	delete(c.liveIDs, id)
+	delete(c.recreateIDs, id)
+	c.recreateMu.Unlock()
+}
+
+func (c *channelPool) takeRecreateMark(id uint64) bool {
+	c.recreateMu.Lock()
+	defer c.recreateMu.Unlock()
+
+	if _, ok := c.recreateIDs[id]; !ok {
+		return false
+	}
+	delete(c.recreateIDs, id)
+	return true
+}
+
+// checkOut 记录连接被取出，连接仍处于取出状态说明同一个底层连接被交给了两个调用方
+func (c *channelPool) checkOut(wrapConn *IdleConn) {
+	c.checkoutMu.Lock()
+	defer c.checkoutMu.Unlock()
 
-	if c.conns == nil {
-		return c.Close(wrapConn)
+	if _, ok := c.checkouts[wrapConn.id]; ok {
+		panic(fmt.Sprintf("go-pool: conn %d handed out while still checked out", wrapConn.id))
 	}
+	c.lastCheckout++
+	c.checkouts[wrapConn.id] = c.lastCheckout
+	wrapConn.checkout = c.lastCheckout
+}
+
+// checkIn 清除连接的取出记录，wrapConn 不是该连接最近一次取出的 IdleConn 时返回 false
+func (c *channelPool) checkIn(wrapConn *IdleConn) bool {
+	c.checkoutMu.Lock()
+	defer c.checkoutMu.Unlock()
 
-	if wrapConn.t.Before(c.initTime) {
-		return c.Close(wrapConn)
+	if checkout, ok := c.checkouts[wrapConn.id]; !ok || checkout != wrapConn.checkout {
+		return false
 	}
+	delete(c.checkouts, wrapConn.id)
+	return true
+}
 
-	conn, err := wrapConn.Get()
+// recreate 关闭连接，沿用其 queue 位置新建连接放入空闲队列，返回新连接的 id
+func (c *channelPool) recreate(wrapConn *IdleConn) (uint64, error) {
+	conn, err := wrapConn.take()
 	if err != nil {
-		return err
+		return 0, err
 	}
-	wrapConn.Close()
+	c.untrackID(wrapConn.id)
+	c.close(conn)
+	c.notifyClose(conn, ReasonUserClose)
 
-	select {
-	case c.conns <- NewIdleConn(conn, time.Now(), c):
-		return nil
-	default:
-		//连接池已满，直接关闭该连接
-		c.Close(wrapConn)
-		return nil
+	newConn, err := c.newConn(context.Background(), wrapConn.queue)
+	if err != nil {
+		return 0, err
 	}
+	if !c.putIdle(newConn) {
+		c.discard(newConn, ReasonRelease)
+		return 0, ErrPoolClosed
+	}
+	return newConn.id, nil
 }
 
-// Close 关闭单条连接
+// Close 关闭单条连接，连接池已 ClosePool 时仍会关闭连接并返回 ErrPoolClosed
 func (c *channelPool) Close(wrapConn *IdleConn) error {
+	return c.discard(wrapConn, ReasonUserClose)
+}
+
+// discard 关闭连接并释放 queue 位置，调用 OnClose
+func (c *channelPool) discard(wrapConn *IdleConn, reason CloseReason) error {
 	if wrapConn == nil {
 		return nil
 	}
 
-	conn, err := wrapConn.Get()
+	conn, err := wrapConn.take()
 	if err != nil {
 		return err
 	}
-	c.freeTurn()
-	wrapConn.Close()
+	// 关闭已取出的连接时清除取出记录
+	if c.checkouts != nil {
+		c.checkIn(wrapConn)
+	}
+	if c.leaks != nil {
+		c.leaks.untrack(wrapConn)
+	}
+	c.untrackID(wrapConn.id)
+	// Release 之前创建的连接释放的是原来的 queue 位置
+	c.freeTurn(wrapConn.queue)
+
+	err = c.close(conn)
+	c.notifyClose(conn, reason)
+	if atomic.LoadInt32(&c.closed) == 1 {
+		return ErrPoolClosed
+	}
+	return err
+}
 
-	return c.close(conn)
+func (c *channelPool) notifyClose(conn interface{}, reason CloseReason) {
+	if c.onClose != nil {
+		c.onClose(conn, reason)
+	}
 }
 
 // Ping 检查单条连接是否有效
@@ -234,30 +1837,288 @@ func (c *channelPool) Ping(wrapConn *IdleConn) error {
 		return ErrWrapConnNil
 	}
 
-	conn, err := wrapConn.Get()
+	// Ping 底层连接而不是 Wrap 包装后的连接
+	conn, err := wrapConn.raw()
 	if err != nil {
 		return err
 	}
 
-	return c.ping(conn)
+	if err := c.pingWithTimeout(conn); err != nil {
+		pingErr := &PingError{
+			ConnID: wrapConn.id,
+			Age:    time.Since(wrapConn.createdAt),
+			Err:    err,
+		}
+		wrapConn.mu.Lock()
+		wrapConn.lastErr = pingErr
+		wrapConn.mu.Unlock()
+		return pingErr
+	}
+	return nil
+}
+
+// pingWithTimeout 调用 ping，超过 pingTimeout 返回 ErrPingTimeout
+// 超时后 ping 的 goroutine 在 ping 返回时退出，结果写入带缓冲的 channel，不会阻塞
+// 单独的 goroutine 中 ping panic 无法由调用方 recover，转为 ErrPingPanicked 返回
+func (c *channelPool) pingWithTimeout(conn interface{}) error {
+	if c.pingTimeout <= 0 {
+		return c.ping(conn)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				result <- fmt.Errorf("%w: %v", ErrPingPanicked, r)
+			}
+		}()
+		result <- c.ping(conn)
+	}()
+
+	timer := time.NewTimer(c.pingTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-result:
+		return err
+	case <-timer.C:
+		return ErrPingTimeout
+	}
 }
 
-// Release 释放连接池中所有连接
+// Release 释放连接池中所有连接，之后连接池仍可使用，后台维护重新启动，连接池已 ClosePool 时不做任何处理
 func (c *channelPool) Release() {
+	if idle := c.reset(); idle != nil {
+		c.closeAll(idle.close(), "release")
+	}
+}
+
+// ReleaseAndWait 同 Release，但不受 ReleaseCloseTimeout 限制，由 releaseWorkers 个 goroutine 并发关闭连接，
+// 等待所有连接关闭后返回关闭失败的 CloseErrors；ctx 先取消或超时则返回 ctx.Err()，剩余的连接在后台继续关闭
+func (c *channelPool) ReleaseAndWait(ctx context.Context) error {
+	idle := c.reset()
+	if idle == nil {
+		return nil
+	}
+	conns := idle.close()
+
+	work := make(chan *IdleConn)
+	errs := make(chan error, len(conns))
+	var wg sync.WaitGroup
+	for i := 0; i < releaseWorkers && i < len(conns); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for wrapConn := range work {
+				if err := c.discard(wrapConn, ReasonRelease); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for _, wrapConn := range conns {
+			work <- wrapConn
+		}
+		close(work)
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	close(errs)
+	var closeErrs CloseErrors
+	for err := range errs {
+		closeErrs = append(closeErrs, err)
+	}
+	if len(closeErrs) > 0 {
+		return closeErrs
+	}
+	return nil
+}
+
+// reset 停止后台 goroutine，更换新的空闲连接列表和 queue，返回原来的空闲连接列表，连接池已关闭时返回 nil
+func (c *channelPool) reset() *idleList {
+	running := c.stopBackground()
+
 	c.mu.Lock()
-	conns := c.conns
-	c.conns = make(chan *IdleConn, cap(conns))
+	defer c.mu.Unlock()
+
+	idle := c.getIdle()
+	if idle == nil {
+		return nil
+	}
+	queue := make(chan struct{}, cap(c.getQueue()))
+	c.idle.Store(newIdleList(idle.cap, idle.isFIFO()))
+	c.queue.Store(&queue)
 	c.initTime = time.Now()
+	atomic.AddUint64(&c.generation, 1)
+	// 新的空闲连接列表重新启动后台维护，NewChannelPool 初始化失败时不启动
+	if running {
+		c.startBackground()
+	}
+	return idle
+}
+
+// ClosePool 关闭所有连接并永久关闭连接池，之后的 Get/Put/Close 返回 ErrPoolClosed
+// 重复调用直接返回 nil
+func (c *channelPool) ClosePool() error {
+	c.stopBackground()
+
+	// 后台 goroutine 退出后、关闭之前输出最后一次统计数据
+	if c.onStats != nil && c.getIdle() != nil {
+		c.finalStatsOnce.Do(func() {
+			c.onStats(c.Stats())
+		})
+	}
+
+	c.mu.Lock()
+	idle := c.getIdle()
+	c.idle.Store(nil)
+	atomic.StoreInt32(&c.closed, 1)
 	c.mu.Unlock()
+	// 同时进行的 Release 可能在上面的 stopBackground 之后重新启动了后台 goroutine
+	c.stopBackground()
+
+	if idle == nil {
+		return nil
+	}
+
+	close(c.closedCh)
+	c.closeAll(idle.close(), "close pool")
+	return nil
+}
+
+// closeAll 并发关闭 conns 中的连接，超过 releaseCloseTimeout 后剩余的连接在后台继续关闭
+func (c *channelPool) closeAll(conns []*IdleConn, op string) {
+	var wg sync.WaitGroup
+	var pending int32
+	for _, conn := range conns {
+		wg.Add(1)
+		atomic.AddInt32(&pending, 1)
+		go func(conn *IdleConn) {
+			defer wg.Done()
+			defer atomic.AddInt32(&pending, -1)
+			c.discard(conn, ReasonRelease)
+		}(conn)
+	}
+
+	if c.releaseCloseTimeout <= 0 {
+		wg.Wait()
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(c.releaseCloseTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+		c.logger.Printf("%s: %d conns still closing after %s, continue in background",
+			op, atomic.LoadInt32(&pending), c.releaseCloseTimeout)
+		go func() {
+			<-done
+			c.logger.Printf("%s: background closes finished", op)
+		}()
+	}
+}
+
+// Quiesce 停止提供和创建连接，逐个关闭空闲连接，放回的连接直接关闭，
+// 所有连接关闭后调用 Release；ctx 取消或超时则立即 Release 并返回 ctx.Err()
+// 与 Release 相同，返回后连接池恢复可用
+func (c *channelPool) Quiesce(ctx context.Context) error {
+	atomic.StoreInt32(&c.quiesced, 1)
+	defer func() {
+		c.Release()
+		atomic.StoreInt32(&c.quiesced, 0)
+	}()
+
+	return c.waitQuiesced(ctx)
+}
+
+// Shutdown 停止提供和创建连接，等待已取出的连接全部放回后永久关闭连接池，
+// 放回的连接直接关闭；ctx 取消或超时则立即 ClosePool 并返回 ctx.Err()
+func (c *channelPool) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&c.quiesced, 1)
+	err := c.waitQuiesced(ctx)
+	if closeErr := c.ClosePool(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// waitQuiesced 逐个关闭空闲连接，等待 queue 中的位置全部释放，即已取出的连接全部放回或关闭
+func (c *channelPool) waitQuiesced(ctx context.Context) error {
+	ticker := time.NewTicker(quiesceInterval)
+	defer ticker.Stop()
+
+	for {
+		idle := c.getIdle()
+		if idle == nil {
+			return nil
+		}
 
-	if conns == nil {
+		if wrapConn := idle.pop(); wrapConn != nil {
+			c.discard(wrapConn, ReasonRelease)
+		} else if len(c.getQueue()) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ResetForReuse 关闭所有空闲连接并清零统计数据，复用已有的空闲连接列表
+func (c *channelPool) ResetForReuse() {
+	idle := c.getIdle()
+	if idle == nil {
 		return
 	}
 
-	close(conns)
-	for conn := range conns {
-		c.Close(conn)
+	defer c.resetStats()
+	for _, wrapConn := range idle.drain() {
+		c.discard(wrapConn, ReasonRelease)
+	}
+}
+
+// resetStats 清零 Stats 中的计数
+func (c *channelPool) resetStats() {
+	atomic.StoreUint64(&c.growthEvents, 0)
+	atomic.StoreUint32(&c.waitCount, 0)
+	atomic.StoreInt64(&c.waitDuration, 0)
+	atomic.StoreUint64(&c.doublePuts, 0)
+	atomic.StoreUint64(&c.hits, 0)
+	atomic.StoreUint64(&c.misses, 0)
+	atomic.StoreUint64(&c.timeouts, 0)
+}
+
+// Drain 关闭所有空闲连接，连接池仍可使用，已取出的连接不受影响
+func (c *channelPool) Drain() error {
+	idle := c.getIdle()
+	if idle == nil {
+		return ErrPoolClosed
+	}
+
+	for _, wrapConn := range idle.drain() {
+		c.discard(wrapConn, ReasonUserClose)
 	}
+	return nil
 }
 
 // Len 连接池中已有的连接
@@ -265,9 +2126,61 @@ func (c *channelPool) Len() int {
 	if c == nil {
 		return 0
 	}
-	conns := c.getConns()
-	if conns == nil {
+	idle := c.getIdle()
+	if idle == nil {
+		return 0
+	}
+	return idle.len()
+}
+
+// Idle 空闲连接数，同 Len
+func (c *channelPool) Idle() int {
+	return c.Len()
+}
+
+// InUse 已取出的连接数，即 queue 中的位置数减去空闲连接数，连接池已关闭时为 0
+// queue 位置在新建连接前占用，因此包括正在为 Get 新建的连接
+func (c *channelPool) InUse() int {
+	if c == nil {
+		return 0
+	}
+	idle := c.getIdle()
+	if idle == nil {
 		return 0
 	}
-	return len(conns)
+	if n := len(c.getQueue()) - idle.len(); n > 0 {
+		return n
+	}
+	return 0
+}
+
+// MaxActive 同时存活（包括已取出）的连接数上限，即 ConcurrentBase*MaxCap
+func (c *channelPool) MaxActive() int {
+	return cap(c.getQueue())
+}
+
+// EstimatedMemory 根据 PerConnBytes 估计的所有存活连接（包括已取出的）占用的内存
+func (c *channelPool) EstimatedMemory() int64 {
+	return int64(len(c.getQueue())) * c.perConnBytes
+}
+
+// Stats 连接池统计数据
+func (c *channelPool) Stats() Stats {
+	idleByTag := make(map[string]int)
+	for _, info := range c.Dump() {
+		idleByTag[info.Tag]++
+	}
+
+	return Stats{
+		GrowthEvents: atomic.LoadUint64(&c.growthEvents),
+		WaitCount:    atomic.LoadUint32(&c.waitCount),
+		WaitDuration: time.Duration(atomic.LoadInt64(&c.waitDuration)),
+		DoublePut:    atomic.LoadUint64(&c.doublePuts),
+		Hits:         atomic.LoadUint64(&c.hits),
+		Misses:       atomic.LoadUint64(&c.misses),
+		Timeouts:     atomic.LoadUint64(&c.timeouts),
+		IdleConns:    c.Len(),
+		TotalConns:   len(c.getQueue()),
+		IdleByTag:    idleByTag,
+	}
 }
@@ -1,26 +1,66 @@
 package go_pool
 
 import (
+	"fmt"
 	"sync"
 	"time"
 )
 
+// IdleConn 包装连接池中的一个连接
+// conn 只在持有 mu 时修改，take 取出 conn 后 IdleConn 失效，每个 IdleConn 只有一次 take 成功，
+// 因此连接只关闭一次、queue 位置只释放一次；Put 放回时用新的 IdleConn 包装连接，
+// 调用方持有的旧 IdleConn 不会再被连接池使用。id、createdAt 等字段在交给调用方或放入空闲列表前设置，之后只读
 type IdleConn struct {
-	mu   sync.RWMutex
-	conn interface{}
-	t    time.Time
-	pool Pool
+	mu      sync.RWMutex
+	resetMu sync.Mutex // Reset 依次执行，新建连接期间不持有 mu
+	conn    interface{}
+	t       time.Time
+	pool    Pool
+
+	id        uint64    // 连接 id，放回 pool 后不变
+	createdAt time.Time // 连接创建时间，放回 pool 后不变
+	tag       string    // 连接标签，由 TagFactory 生成
+	addr      string    // 创建时缓存的远端地址，由 AddrOf 生成
+	affinity  string    // 最近一次 GetAffinity 的 key，放回 pool 后不变
+
+	meta    map[string]interface{} // 连接元数据，由 FactoryMeta 生成，放回 pool 后不变
+	wrapped interface{}            // Wrap 包装后的连接，Get 返回该连接，放回 pool 时清除
+
+	queue      chan struct{} // 连接占用位置的 queue，Release 之后仍释放到原来的 queue
+	generation uint64        // 开始生成连接时连接池的代数，放回 pool 后不变
+
+	keepWarmUntil time.Time     // 该时间之前不会因 idleTimeout 被丢弃
+	idleTimeout   time.Duration // 该连接的空闲超时时间，包含 IdleTimeoutJitter 的随机部分，0 表示使用 IdleTimeout
+	fresh         bool          // Get 时是否新建，而非取自空闲连接
+	uses          int           // 被 Get 取出的次数，放回 pool 后不变
+	lastErr       error         // 取出期间最近一次 Ping 的错误，放回时交给 RetainOnPut
+	checkout      uint64        // DetectReuse 时本次取出的序号
 }
 
 func NewIdleConn(conn interface{}, t time.Time, pool Pool) *IdleConn {
 	return &IdleConn{
-		conn: conn,
-		t:    t,
-		pool: pool,
+		conn:      conn,
+		t:         t,
+		pool:      pool,
+		createdAt: t,
 	}
 }
 
+// Get 返回连接，设置了 Config.Wrap 时返回包装后的连接
 func (i *IdleConn) Get() (interface{}, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.conn == nil {
+		return nil, ErrConnClosed
+	}
+	if i.wrapped != nil {
+		return i.wrapped, nil
+	}
+	return i.conn, nil
+}
+
+// raw 返回连接池中保存的连接，不经过 Wrap
+func (i *IdleConn) raw() (interface{}, error) {
 	i.mu.RLock()
 	defer i.mu.RUnlock()
 	if i.conn == nil {
@@ -29,15 +69,107 @@ func (i *IdleConn) Get() (interface{}, error) {
 	return i.conn, nil
 }
 
+// take 取出底层连接并关闭 IdleConn，并发调用时只有一次成功，保证 queue 位置只释放一次
+func (i *IdleConn) take() (interface{}, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.conn == nil {
+		return nil, ErrConnClosed
+	}
+	conn := i.conn
+	i.conn = nil
+	i.wrapped = nil
+	i.t = time.Time{}
+	i.pool = nil
+	return conn, nil
+}
+
 func (i *IdleConn) Close() error {
 	i.mu.Lock()
 	i.conn = nil
+	i.wrapped = nil
 	i.t = time.Time{}
 	i.pool = nil
 	i.mu.Unlock()
 	return nil
 }
 
+// staleChecker 可以判断 IdleConn 是否属于 Release 之前的 Pool
+type staleChecker interface {
+	stale(wrapConn *IdleConn) bool
+}
+
+// Stale 连接是否在 pool Release 或 InvalidateAll 之前生成或取出，这样的连接放回时会被关闭
+func (i *IdleConn) Stale() (bool, error) {
+	i.mu.RLock()
+	pool := i.pool
+	closed := i.conn == nil
+	i.mu.RUnlock()
+	if closed {
+		return false, ErrConnClosed
+	}
+
+	checker, ok := pool.(staleChecker)
+	if !ok {
+		return false, fmt.Errorf("%w: %T", ErrConnType, pool)
+	}
+	return checker.stale(i), nil
+}
+
+// connRedialer 可以为 IdleConn 重新生成底层连接的 Pool
+type connRedialer interface {
+	// redial 新建连接，不占用 queue 位置
+	redial() (*IdleConn, error)
+	// closeReplaced 关闭不占用 queue 位置的连接
+	closeReplaced(conn interface{}, reason CloseReason)
+}
+
+// Reset 通过 pool 新建底层连接代替当前的连接并关闭当前的连接，IdleConn 和占用的 queue 位置不变
+// 新建失败时保留当前的连接，新建期间不持有锁
+func (i *IdleConn) Reset() error {
+	i.resetMu.Lock()
+	defer i.resetMu.Unlock()
+
+	i.mu.RLock()
+	old := i.conn
+	pool := i.pool
+	i.mu.RUnlock()
+	if old == nil {
+		return ErrConnClosed
+	}
+
+	redialer, ok := pool.(connRedialer)
+	if !ok {
+		return fmt.Errorf("%w: %T", ErrConnType, pool)
+	}
+	next, err := redialer.redial()
+	if err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	// 新建期间连接已被放回或关闭
+	if i.conn == nil {
+		i.mu.Unlock()
+		redialer.closeReplaced(next.conn, ReasonUserClose)
+		return ErrConnClosed
+	}
+	defer redialer.closeReplaced(old, ReasonUserClose)
+	defer i.mu.Unlock()
+
+	i.conn = next.conn
+	i.tag = next.tag
+	i.meta = next.meta
+	i.wrapped = next.wrapped
+	i.addr = next.addr
+	i.createdAt = next.createdAt
+	i.idleTimeout = next.idleTimeout
+	i.generation = next.generation
+	i.uses = 0
+	i.lastErr = nil
+	return nil
+}
+
 func (i *IdleConn) GetPool() (Pool, error) {
 	i.mu.RLock()
 	defer i.mu.RUnlock()
@@ -46,3 +178,80 @@ func (i *IdleConn) GetPool() (Pool, error) {
 	}
 	return i.pool, nil
 }
+
+// ID 连接 id，同一个底层连接放回 pool 后 id 不变
+func (i *IdleConn) ID() (uint64, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.conn == nil {
+		return 0, ErrConnClosed
+	}
+	return i.id, nil
+}
+
+// Tag 连接标签，由 TagFactory 生成
+func (i *IdleConn) Tag() (string, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.conn == nil {
+		return "", ErrConnClosed
+	}
+	return i.tag, nil
+}
+
+// LastUsed 连接上次放回 pool 的时间，新建的连接为创建时间
+func (i *IdleConn) LastUsed() (time.Time, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.conn == nil {
+		return time.Time{}, ErrConnClosed
+	}
+	return i.t, nil
+}
+
+// Age 连接创建至今的时间，放回 pool 后继续累计
+func (i *IdleConn) Age() (time.Duration, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.conn == nil {
+		return 0, ErrConnClosed
+	}
+	return time.Since(i.createdAt), nil
+}
+
+// Uses 连接被 Get 取出的次数
+func (i *IdleConn) Uses() (int, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.conn == nil {
+		return 0, ErrConnClosed
+	}
+	return i.uses, nil
+}
+
+// Addr 创建时缓存的远端地址，由 AddrOf 生成
+func (i *IdleConn) Addr() (string, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.conn == nil {
+		return "", ErrConnClosed
+	}
+	return i.addr, nil
+}
+
+// Meta 连接元数据，由 FactoryMeta 生成
+func (i *IdleConn) Meta() (map[string]interface{}, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.conn == nil {
+		return nil, ErrConnClosed
+	}
+	return i.meta, nil
+}
+
+// Fresh Get 时是否新建的连接，false 表示取自空闲连接
+func (i *IdleConn) Fresh() bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.fresh
+}
@@ -0,0 +1,51 @@
+package go_pool
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type acquireInfoKey struct{}
+
+// AcquireInfo GetContext 获取连接的相关信息
+type AcquireInfo struct {
+	Duration time.Duration // 获取连接的耗时
+	Fresh    bool          // 是否为新建的连接
+}
+
+type acquireInfoHolder struct {
+	mu   sync.Mutex
+	info AcquireInfo
+	set  bool
+}
+
+// WithAcquireInfo 返回可记录 AcquireInfo 的 ctx，传给 GetContext 后通过 AcquireInfoFromContext 读取
+func WithAcquireInfo(ctx context.Context) context.Context {
+	return context.WithValue(ctx, acquireInfoKey{}, &acquireInfoHolder{})
+}
+
+// AcquireInfoFromContext 读取 GetContext 记录的 AcquireInfo
+// ctx 未经 WithAcquireInfo 包装或尚未成功获取连接时返回 false
+func AcquireInfoFromContext(ctx context.Context) (AcquireInfo, bool) {
+	holder, ok := ctx.Value(acquireInfoKey{}).(*acquireInfoHolder)
+	if !ok {
+		return AcquireInfo{}, false
+	}
+
+	holder.mu.Lock()
+	defer holder.mu.Unlock()
+	return holder.info, holder.set
+}
+
+func setAcquireInfo(ctx context.Context, info AcquireInfo) {
+	holder, ok := ctx.Value(acquireInfoKey{}).(*acquireInfoHolder)
+	if !ok {
+		return
+	}
+
+	holder.mu.Lock()
+	holder.info = info
+	holder.set = true
+	holder.mu.Unlock()
+}
@@ -0,0 +1,220 @@
+package go_pool
+
+import "sync"
+
+// idleList 空闲连接列表，按放回的先后顺序保存，fifo 决定从哪一端取出
+// 有等待的 Get 时放入的连接按等待的先后顺序直接交给等待方，不进入列表
+type idleList struct {
+	mu      sync.Mutex
+	conns   []*IdleConn // 先放回的在前
+	cap     int
+	fifo    bool
+	closed  bool             // Release 或 ClosePool 后不再接收连接
+	waiters []chan *IdleConn // 等待的 Get，先等待的在前
+	done    chan struct{}    // 列表关闭时 close
+}
+
+func newIdleList(cap int, fifo bool) *idleList {
+	return &idleList{
+		conns: make([]*IdleConn, 0, cap),
+		cap:   cap,
+		fifo:  fifo,
+		done:  make(chan struct{}),
+	}
+}
+
+// push 放入连接，有等待的 Get 时直接交给最先等待的，列表已满或已关闭时返回 false
+func (l *idleList) push(wrapConn *IdleConn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return false
+	}
+	if len(l.waiters) > 0 {
+		l.handOffLocked(wrapConn)
+		return true
+	}
+	if len(l.conns) >= l.cap {
+		return false
+	}
+	l.conns = append(l.conns, wrapConn)
+	return true
+}
+
+// handOffLocked 将连接交给最先等待的 Get，waiter 的缓冲为 1 且只会收到一个连接，不会阻塞
+func (l *idleList) handOffLocked(wrapConn *IdleConn) {
+	waiter := l.waiters[0]
+	copy(l.waiters, l.waiters[1:])
+	l.waiters[len(l.waiters)-1] = nil
+	l.waiters = l.waiters[:len(l.waiters)-1]
+	waiter <- wrapConn
+}
+
+// pop 取出一个连接，没有空闲连接时返回 nil
+func (l *idleList) pop() *IdleConn {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.popLocked()
+}
+
+// popOrWait 取出一个连接，没有空闲连接时加入等待队列，返回接收连接的 waiter，列表已关闭时 closed 为 true
+// waiter 收到 nil 并关闭表示列表已关闭；不再等待时需调用 cancelWait
+func (l *idleList) popOrWait() (wrapConn *IdleConn, waiter chan *IdleConn, closed bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil, nil, true
+	}
+	if wrapConn = l.popLocked(); wrapConn != nil {
+		return wrapConn, nil, false
+	}
+	waiter = make(chan *IdleConn, 1)
+	l.waiters = append(l.waiters, waiter)
+	return nil, waiter, false
+}
+
+// cancelWait 将 waiter 移出等待队列，返回 false 表示已经交付了连接或列表已关闭
+func (l *idleList) cancelWait(waiter chan *IdleConn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, w := range l.waiters {
+		if w == waiter {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (l *idleList) popLocked() *IdleConn {
+	n := len(l.conns)
+	if n == 0 {
+		return nil
+	}
+
+	var wrapConn *IdleConn
+	if l.fifo {
+		wrapConn = l.conns[0]
+		copy(l.conns, l.conns[1:])
+	} else {
+		wrapConn = l.conns[n-1]
+	}
+	l.conns[n-1] = nil
+	l.conns = l.conns[:n-1]
+	return wrapConn
+}
+
+// popMatch 取出最近放回的满足 match 的连接，没有时返回 nil
+func (l *idleList) popMatch(match func(wrapConn *IdleConn) bool) *IdleConn {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i := len(l.conns) - 1; i >= 0; i-- {
+		if wrapConn := l.conns[i]; match(wrapConn) {
+			l.conns = append(l.conns[:i], l.conns[i+1:]...)
+			return wrapConn
+		}
+	}
+	return nil
+}
+
+// drain 取出所有连接，列表仍可继续使用
+func (l *idleList) drain() []*IdleConn {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	conns := l.conns
+	l.conns = make([]*IdleConn, 0, l.cap)
+	return conns
+}
+
+// snapshot 当前空闲连接的副本，不取出
+func (l *idleList) snapshot() []*IdleConn {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]*IdleConn(nil), l.conns...)
+}
+
+// remove 取出指定的连接，连接已不在列表中时返回 false
+func (l *idleList) remove(wrapConn *IdleConn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, conn := range l.conns {
+		if conn == wrapConn {
+			l.conns = append(l.conns[:i], l.conns[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// reinsert 将 remove 取出的连接按放回时间放回原来的位置，有等待的 Get 时直接交给最先等待的，放不下时返回 false
+func (l *idleList) reinsert(wrapConn *IdleConn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return false
+	}
+	if len(l.waiters) > 0 {
+		l.handOffLocked(wrapConn)
+		return true
+	}
+	if len(l.conns) >= l.cap {
+		return false
+	}
+
+	i := len(l.conns)
+	for i > 0 && l.conns[i-1].t.After(wrapConn.t) {
+		i--
+	}
+	l.conns = append(l.conns, nil)
+	copy(l.conns[i+1:], l.conns[i:])
+	l.conns[i] = wrapConn
+	return true
+}
+
+// close 关闭列表并取出所有连接，唤醒等待的 Get
+func (l *idleList) close() []*IdleConn {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.closed {
+		l.closed = true
+		close(l.done)
+	}
+	for _, waiter := range l.waiters {
+		close(waiter)
+	}
+	l.waiters = nil
+	conns := l.conns
+	l.conns = nil
+	return conns
+}
+
+// setFIFO 更改取出顺序，已有的连接保持放回的先后顺序
+func (l *idleList) setFIFO(fifo bool) {
+	l.mu.Lock()
+	l.fifo = fifo
+	l.mu.Unlock()
+}
+
+func (l *idleList) isFIFO() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.fifo
+}
+
+func (l *idleList) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.conns)
+}
@@ -0,0 +1,83 @@
+package go_pool
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Dump 当前空闲连接的快照，只读取不取出，不影响并发的 Get 和 Put
+func (c *channelPool) Dump() []ConnInfo {
+	idle := c.getIdle()
+	if idle == nil {
+		return nil
+	}
+
+	var infos []ConnInfo
+	for _, wrapConn := range idle.snapshot() {
+		wrapConn.mu.RLock()
+		infos = append(infos, ConnInfo{
+			ID:        wrapConn.id,
+			Tag:       wrapConn.tag,
+			Addr:      wrapConn.addr,
+			CreatedAt: wrapConn.createdAt,
+			LastUsed:  wrapConn.t,
+		})
+		wrapConn.mu.RUnlock()
+	}
+	return infos
+}
+
+// DOT 以 Graphviz DOT 格式输出当前空闲连接和已取出连接的快照
+func (c *channelPool) DOT() string {
+	infos := c.Dump()
+	return renderDOT(infos, c.inUseIDs(infos), time.Now())
+}
+
+// inUseIDs 不在 idle 中的存活连接 id，即已取出的连接，按 id 排序
+func (c *channelPool) inUseIDs(idle []ConnInfo) []uint64 {
+	idleIDs := make(map[uint64]struct{}, len(idle))
+	for _, info := range idle {
+		idleIDs[info.ID] = struct{}{}
+	}
+
+	c.recreateMu.Lock()
+	var ids []uint64
+	for id := range c.liveIDs {
+		if _, ok := idleIDs[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	c.recreateMu.Unlock()
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// renderDOT 根据快照生成 DOT，只依赖传入的参数，inUse 为已取出连接的 id
+func renderDOT(infos []ConnInfo, inUse []uint64, now time.Time) string {
+	var b strings.Builder
+	b.WriteString("digraph pool {\n")
+	fmt.Fprintf(&b, "\tpool [shape=box, label=\"pool\\nidle=%d\\nin_use=%d\"];\n", len(infos), len(inUse))
+	for _, info := range infos {
+		label := fmt.Sprintf("#%d idle\\nage %s\\nidle %s",
+			info.ID, now.Sub(info.CreatedAt).Round(time.Millisecond), now.Sub(info.LastUsed).Round(time.Millisecond))
+		if info.Tag != "" {
+			label += "\\ntag " + dotEscaper.Replace(info.Tag)
+		}
+		if info.Addr != "" {
+			label += "\\naddr " + dotEscaper.Replace(info.Addr)
+		}
+		fmt.Fprintf(&b, "\tconn%d [label=\"%s\"];\n", info.ID, label)
+		fmt.Fprintf(&b, "\tpool -> conn%d;\n", info.ID)
+	}
+	for _, id := range inUse {
+		fmt.Fprintf(&b, "\tconn%d [label=\"#%d in use\", style=dashed];\n", id, id)
+		fmt.Fprintf(&b, "\tpool -> conn%d [style=dashed];\n", id)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
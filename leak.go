@@ -0,0 +1,91 @@
+package go_pool
+
+import (
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// leakTracker 记录已取出的连接，找出超过 threshold 仍未放回的连接
+type leakTracker struct {
+	mu        sync.Mutex
+	threshold time.Duration
+	stack     bool
+	borrowed  map[*IdleConn]*borrow
+}
+
+// borrow 一次取出的时间和调用栈
+type borrow struct {
+	at       time.Time
+	stack    []byte
+	reported bool // 每次取出只报告一次
+}
+
+func newLeakTracker(threshold time.Duration, stack bool) *leakTracker {
+	return &leakTracker{
+		threshold: threshold,
+		stack:     stack,
+		borrowed:  make(map[*IdleConn]*borrow),
+	}
+}
+
+func (l *leakTracker) track(wrapConn *IdleConn) {
+	b := &borrow{at: time.Now()}
+	if l.stack {
+		b.stack = debug.Stack()
+	}
+
+	l.mu.Lock()
+	l.borrowed[wrapConn] = b
+	l.mu.Unlock()
+}
+
+func (l *leakTracker) untrack(wrapConn *IdleConn) {
+	l.mu.Lock()
+	delete(l.borrowed, wrapConn)
+	l.mu.Unlock()
+}
+
+// leaked 返回取出超过 threshold 且尚未报告的连接
+func (l *leakTracker) leaked(now time.Time) map[*IdleConn]*borrow {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var leaks map[*IdleConn]*borrow
+	for wrapConn, b := range l.borrowed {
+		if b.reported || now.Sub(b.at) < l.threshold {
+			continue
+		}
+		b.reported = true
+		if leaks == nil {
+			leaks = make(map[*IdleConn]*borrow)
+		}
+		leaks[wrapConn] = b
+	}
+	return leaks
+}
+
+// leakScanner 定期输出取出超过 ConnLeakThreshold 仍未放回的连接
+func (c *channelPool) leakScanner(done <-chan struct{}) {
+	interval := c.leaks.threshold / 2
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			for wrapConn, b := range c.leaks.leaked(now) {
+				if b.stack != nil {
+					c.logger.Printf("conn %d not returned after %s, borrowed at:\n%s", wrapConn.id, now.Sub(b.at), b.stack)
+				} else {
+					c.logger.Printf("conn %d not returned after %s", wrapConn.id, now.Sub(b.at))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package go_pool
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// MockConn NewMockFactory 生成的内存连接
+type MockConn struct {
+	ID uint64
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// Closed 连接是否已被关闭
+func (m *MockConn) Closed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.closed
+}
+
+// MockStats 记录 NewMockFactory 生成和关闭的连接数，可以注入生成、Ping 和关闭的错误
+type MockStats struct {
+	mu       sync.Mutex
+	created  int
+	closed   int
+	dialErr  error
+	pingErr  error
+	closeErr error
+}
+
+// NewMockFactory 生成内存连接的 Factory 和 Close，用于不依赖网络的测试，
+// 连接为 *MockConn，Ping 可以使用 MockStats.Ping
+func NewMockFactory() (func() (interface{}, error), func(interface{}) error, *MockStats) {
+	stats := &MockStats{}
+	return stats.dial, stats.close, stats
+}
+
+func (s *MockStats) dial() (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dialErr != nil {
+		return nil, s.dialErr
+	}
+	s.created++
+	return &MockConn{ID: uint64(s.created)}, nil
+}
+
+func (s *MockStats) close(conn interface{}) error {
+	m, ok := conn.(*MockConn)
+	if !ok {
+		return fmt.Errorf("%w: %T", ErrConnType, conn)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return errors.New("mock conn closed twice")
+	}
+	m.closed = true
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed++
+	return s.closeErr
+}
+
+// Ping 检查 *MockConn，连接已关闭或设置了 SetPingError 时返回错误
+func (s *MockStats) Ping(conn interface{}) error {
+	m, ok := conn.(*MockConn)
+	if !ok {
+		return fmt.Errorf("%w: %T", ErrConnType, conn)
+	}
+	if m.Closed() {
+		return ErrConnClosed
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pingErr
+}
+
+// SetDialError 之后生成连接返回 err，nil 表示恢复正常
+func (s *MockStats) SetDialError(err error) {
+	s.mu.Lock()
+	s.dialErr = err
+	s.mu.Unlock()
+}
+
+// SetPingError 之后 Ping 返回 err，nil 表示恢复正常
+func (s *MockStats) SetPingError(err error) {
+	s.mu.Lock()
+	s.pingErr = err
+	s.mu.Unlock()
+}
+
+// SetCloseError 之后关闭连接返回 err，连接仍视为已关闭，nil 表示恢复正常
+func (s *MockStats) SetCloseError(err error) {
+	s.mu.Lock()
+	s.closeErr = err
+	s.mu.Unlock()
+}
+
+// Created 已生成的连接数
+func (s *MockStats) Created() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.created
+}
+
+// Closed 已关闭的连接数
+func (s *MockStats) Closed() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// Open 未关闭的连接数
+func (s *MockStats) Open() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.created - s.closed
+}
@@ -0,0 +1,48 @@
+package go_pool
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMockFactory(t *testing.T) {
+	factory, closer, stats := NewMockFactory()
+	p, err := NewChannelPool(&Config{
+		InitialCap: 2,
+		MaxCap:     4,
+		Factory:    factory,
+		Close:      closer,
+		Ping:       stats.Ping,
+	})
+	if err != nil {
+		t.Fatalf("NewChannelPool error: %s", err)
+	}
+
+	conns, err := p.BatchGet(4)
+	if err != nil {
+		t.Fatalf("BatchGet error: %s", err)
+	}
+	for _, wrapConn := range conns {
+		p.Put(wrapConn)
+	}
+
+	errPing := errors.New("ping failed")
+	wrapConn, _ := p.Get()
+	stats.SetPingError(errPing)
+	if err := p.Ping(wrapConn); !errors.Is(err, errPing) {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", errPing, err)
+	}
+	stats.SetPingError(nil)
+	p.Put(wrapConn)
+
+	if n := stats.Created(); n != 4 {
+		t.Errorf("%d conns were created but should be 4", n)
+	}
+	p.Release()
+	if created, closed := stats.Created(), stats.Closed(); closed != created {
+		t.Errorf("%d conns were closed but %d were created", closed, created)
+	}
+	if n := stats.Open(); n != 0 {
+		t.Errorf("%d conns were still open but should be 0", n)
+	}
+}
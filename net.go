@@ -0,0 +1,55 @@
+package go_pool
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// netPingTimeout NetConnPing 等待读取的时间
+const netPingTimeout = time.Millisecond
+
+// NetDialFactory 通过 net.Dial 生成连接的 Factory
+func NetDialFactory(network, addr string) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		return net.Dial(network, addr)
+	}
+}
+
+// NetConnClose 关闭 net.Conn 的 Close
+func NetConnClose() func(interface{}) error {
+	return func(conn interface{}) error {
+		c, ok := conn.(net.Conn)
+		if !ok {
+			return fmt.Errorf("%w: %T", ErrConnType, conn)
+		}
+		return c.Close()
+	}
+}
+
+// NetConnPing 检查 net.Conn 是否有效的 Ping，设置很短的读超时尝试读取，
+// 超时说明连接仍然有效；读到 EOF 等错误说明连接已断开；读到数据则该数据已丢失，连接同样视为无效
+func NetConnPing() func(interface{}) error {
+	return func(conn interface{}) error {
+		c, ok := conn.(net.Conn)
+		if !ok {
+			return fmt.Errorf("%w: %T", ErrConnType, conn)
+		}
+
+		if err := c.SetReadDeadline(time.Now().Add(netPingTimeout)); err != nil {
+			return err
+		}
+		defer c.SetReadDeadline(time.Time{})
+
+		n, err := c.Read(make([]byte, 1))
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("unexpected %d bytes read from idle conn", n)
+	}
+}
@@ -0,0 +1,39 @@
+package go_pool
+
+import (
+	"net"
+	"testing"
+)
+
+func TestNetHelpers(t *testing.T) {
+	p, err := NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     2,
+		Factory:    NetDialFactory(network, address),
+		Close:      NetConnClose(),
+		Ping:       NetConnPing(),
+	})
+	if err != nil {
+		t.Fatalf("NewChannelPool error: %s", err)
+	}
+	defer p.Release()
+
+	wrapConn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	if err := p.Ping(wrapConn); err != nil {
+		t.Errorf("Ping returned an error: %s", err)
+	}
+
+	conn, _ := wrapConn.Get()
+	conn.(net.Conn).Close()
+	if err := p.Ping(wrapConn); err == nil {
+		t.Error("Ping of a closed conn should return an error")
+	}
+	p.Close(wrapConn)
+
+	if err := NetConnClose()("not a conn"); err == nil {
+		t.Error("Close of a non net.Conn should return an error")
+	}
+}
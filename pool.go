@@ -1,7 +1,12 @@
 package go_pool
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
 	"time"
 )
 
@@ -15,11 +20,151 @@ var (
 	ErrConnGenerateFailed = errors.New("conn generate failed")
 
 	ErrWrapConnNil = errors.New("wrap conn is nil. rejecting")
+
+	ErrConnType = errors.New("conn type mismatch")
+
+	ErrConnNotCloser = errors.New("conn does not implement io.Closer")
+
+	ErrCreationDisabled = errors.New("conn creation is disabled")
+
+	ErrPartialFill = errors.New("pool is partially filled")
+
+	ErrPingTimeout = errors.New("ping timed out")
+
+	ErrPingPanicked = errors.New("ping panicked")
+
+	ErrConnReused = errors.New("conn is checked out by another caller")
+
+	ErrTooManyWaiters = errors.New("too many waiters")
+
+	ErrRateLimited = errors.New("conn creation rate limited")
 )
 
+// Config.Validate 返回的配置错误
+var (
+	ErrInvalidCapacity           = errors.New("invalid capacity settings")
+	ErrInvalidConcurrentBase     = errors.New("invalid concurrent base settings")
+	ErrNilFactory                = errors.New("invalid factory func settings")
+	ErrNilClose                  = errors.New("invalid close func settings")
+	ErrInvalidWatermark          = errors.New("invalid watermark settings")
+	ErrMinIdleExceedsMax         = errors.New("invalid min idle settings")
+	ErrInvalidWarmupTarget       = errors.New("invalid warmup target settings")
+	ErrInvalidConnectRetry       = errors.New("invalid connect retry settings")
+	ErrInvalidMaxConnUses        = errors.New("invalid max conn uses settings")
+	ErrInvalidMaxWaiters         = errors.New("invalid max waiters settings")
+	ErrInvalidConnLeakThreshold  = errors.New("invalid conn leak threshold settings")
+	ErrInvalidCreateRate         = errors.New("invalid create rate settings")
+	ErrInvalidAdaptiveTimeout    = errors.New("invalid adaptive timeout settings")
+	ErrInvalidPoolTimeout        = errors.New("invalid pool timeout settings")
+	ErrInvalidIdleCheckFrequency = errors.New("invalid idle check frequency settings")
+	ErrInvalidKeepAlive          = errors.New("invalid keep alive settings")
+	ErrInvalidExpiryGrace        = errors.New("invalid expiry grace settings")
+)
+
+// PingError Ping 失败时返回，包含失败连接的 id 和存活时间
+type PingError struct {
+	ConnID uint64
+	Age    time.Duration
+	Err    error
+}
+
+func (e *PingError) Error() string {
+	return fmt.Sprintf("ping conn %d (age %s) failed: %s", e.ConnID, e.Age, e.Err)
+}
+
+func (e *PingError) Unwrap() error {
+	return e.Err
+}
+
+// CloseErrors ReleaseAndWait 关闭连接时返回的所有错误，可以通过 errors.Is 和 errors.As 匹配其中的单个错误
+type CloseErrors []error
+
+func (e CloseErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d conns failed to close: %s", len(e), strings.Join(msgs, "; "))
+}
+
+func (e CloseErrors) Unwrap() []error {
+	return e
+}
+
+// CloseReason 连接被永久关闭的原因
+type CloseReason int
+
+const (
+	ReasonIdle            CloseReason = iota // 空闲超时
+	ReasonPingFailed                         // Ping 失败
+	ReasonPoolFull                           // 放回时连接池已满
+	ReasonRelease                            // 连接池 Release 或关闭
+	ReasonUserClose                          // 调用方主动关闭
+	ReasonMaxLifetime                        // 超过最大存活时间
+	ReasonValidateFailed                     // 未通过 GetValidated 的检查
+	ReasonMaxUses                            // 达到最大使用次数
+	ReasonNotRetained                        // RetainOnPut 返回 false
+	ReasonHookFailed                         // OnGet 或 OnPut 返回错误
+	ReasonBroken                             // PutErr 传入了错误
+	ReasonInvalidated                        // InvalidateAll 之前生成的连接
+	ReasonKeepAliveFailed                    // KeepAliveFunc 返回错误
+)
+
+var closeReasonNames = [...]string{
+	ReasonIdle:            "idle",
+	ReasonPingFailed:      "ping failed",
+	ReasonPoolFull:        "pool full",
+	ReasonRelease:         "release",
+	ReasonUserClose:       "user close",
+	ReasonMaxLifetime:     "max lifetime",
+	ReasonValidateFailed:  "validate failed",
+	ReasonMaxUses:         "max uses",
+	ReasonNotRetained:     "not retained",
+	ReasonHookFailed:      "hook failed",
+	ReasonBroken:          "broken",
+	ReasonInvalidated:     "invalidated",
+	ReasonKeepAliveFailed: "keepalive failed",
+}
+
+func (r CloseReason) String() string {
+	if r < 0 || int(r) >= len(closeReasonNames) {
+		return fmt.Sprintf("CloseReason(%d)", int(r))
+	}
+	return closeReasonNames[r]
+}
+
 var (
 	PoolTimeoutInit = time.Second
 	IdleCheckInit   = 30 * time.Minute
+
+	MinIdleCheckInit = time.Second
+)
+
+// Logger 日志接口，*log.Logger 满足该接口
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+var defaultLogger Logger = log.New(os.Stderr, "go-pool: ", log.LstdFlags)
+
+// quiesceInterval Quiesce 逐个关闭空闲连接的间隔
+const quiesceInterval = 10 * time.Millisecond
+
+// releaseWorkers ReleaseAndWait 并发关闭连接的 goroutine 数量
+const releaseWorkers = 8
+
+// 后台 goroutine panic 后重新运行的间隔
+const (
+	restartBackoffBase = 10 * time.Millisecond
+	restartBackoffMax  = 5 * time.Second
+)
+
+// IdleStore 空闲连接的取出顺序
+type IdleStore int
+
+const (
+	LIFOStore IdleStore = iota // 优先取出最近放回的连接
+	FIFOStore                  // 优先取出最先放回的连接
 )
 
 // Pool 基本方法
@@ -27,15 +172,136 @@ type Pool interface {
 	// 获取 WrapConn
 	Get() (*IdleConn, error)
 
+	// 获取 WrapConn，以 d 代替 PoolTimeout，0 表示不等待，小于 0 表示使用 PoolTimeout
+	GetTimeout(d time.Duration) (*IdleConn, error)
+
+	// 获取底层连接，调用 release 放回
+	GetRaw() (conn interface{}, release func() error, err error)
+
+	// 获取 WrapConn，支持 ctx 取消和超时
+	GetContext(context.Context) (*IdleConn, error)
+
+	// 获取通过 validate 检查的 WrapConn
+	GetValidated(ctx context.Context, validate func(conn interface{}) bool) (*IdleConn, error)
+
+	// 获取 WrapConn，优先复用最近一次以相同 key 取出的空闲连接
+	GetAffinity(key string) (*IdleConn, error)
+
+	// 获取 n 个 WrapConn，失败时放回已获取的连接
+	BatchGet(n int) ([]*IdleConn, error)
+
+	// 获取最多 n 个 WrapConn，失败时返回已获取的连接和错误，返回的连接由调用方放回
+	GetMultiContext(ctx context.Context, n int) ([]*IdleConn, error)
+
+	// 获取 WrapConn，不等待 queue 位置
+	TryGet() (*IdleConn, error)
+
 	Put(*IdleConn) error
 
+	// err 不为 nil 时关闭连接，否则同 Put
+	PutErr(wrapConn *IdleConn, err error) error
+
+	// 放回连接，d 时间内不会因空闲超时被丢弃
+	PutKeepWarm(*IdleConn, time.Duration) error
+
 	// 关闭单连接 idleConn
 	Close(*IdleConn) error
 
 	// 释放连接池中所有连接
 	Release()
 
+	// 释放连接池中所有连接，等待连接全部关闭
+	ReleaseAndWait(context.Context) error
+
+	// 永久关闭连接池，与 Release 不同，之后连接池不可再使用
+	ClosePool() error
+
+	// 关闭空闲连接并清零统计数据，不重新分配 channel
+	ResetForReuse()
+
+	// 关闭所有空闲连接，连接池仍可使用
+	Drain() error
+
+	// 对每个空闲连接调用 fn，关闭 fn 返回 false 的连接
+	ForEach(fn func(conn interface{}, lastUsed time.Time) bool) (closed int)
+
+	// 立即清理一次超时的空闲连接
+	ReapNow() (evicted int)
+
+	// 新建最多 n 个空闲连接
+	Warmup(n int) error
+
+	// 后台新建 n 个空闲连接，完成后 Ready 返回的 channel 关闭
+	WarmupAsync(n int)
+	Ready() <-chan struct{}
+
+	// 更改空闲连接的取出顺序
+	SetIdleStore(store IdleStore)
+
+	// 禁止和恢复新建连接，禁止期间只使用空闲连接
+	DisableCreation()
+	EnableCreation()
+
+	// 停止提供连接，等待连接逐渐关闭后释放连接池
+	Quiesce(context.Context) error
+
+	// 停止提供连接，等待已取出的连接全部放回后永久关闭连接池
+	Shutdown(context.Context) error
+
 	Ping(*IdleConn) error
 
 	Len() int
+
+	// 空闲连接数，同 Len
+	Idle() int
+
+	// 已取出的连接数
+	InUse() int
+
+	// 连接池统计数据
+	Stats() Stats
+
+	// 连接池的代数，每次 Release 或 InvalidateAll 加 1
+	Generation() uint64
+
+	// 使现有的连接全部失效，空闲连接在下次 Get 时重建，已取出的连接放回时关闭
+	InvalidateAll()
+
+	// 同时存活的连接数上限
+	MaxActive() int
+
+	// 存活连接占用内存的估计值
+	EstimatedMemory() int64
+
+	// 空闲连接快照
+	Dump() []ConnInfo
+
+	// DOT 格式的空闲连接和已取出连接快照
+	DOT() string
+
+	// 替换指定 id 的连接
+	RecreateByID(id uint64) (uint64, error)
+}
+
+// Stats 连接池统计数据
+type Stats struct {
+	GrowthEvents uint64         // 存活连接数超出 InitialCap，按需创建连接的次数
+	IdleByTag    map[string]int // 按标签统计的空闲连接数
+	WaitCount    uint32         // Get 没有可用连接而阻塞等待的次数
+	WaitDuration time.Duration  // Get 阻塞等待的累计时间
+	DoublePut    uint64         // Put 已放回或关闭的连接的次数
+	Hits         uint64         // Get 复用空闲连接的次数
+	Misses       uint64         // Get 新建连接的次数
+	Timeouts     uint64         // Get 返回 ErrPoolTimeout 的次数
+	IdleConns    int            // 空闲连接数
+	TotalConns   int            // 存活连接数，包括已取出的连接
+}
+
+// ConnInfo 空闲连接快照信息
+type ConnInfo struct {
+	ID        uint64
+	Tag       string
+	Addr      string
+	CreatedAt time.Time
+	LastUsed  time.Time
 }
@@ -1,9 +1,14 @@
 package go_pool
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -12,6 +17,12 @@ var (
 	network = "tcp"
 	address = "127.0.0.1:7777"
 	factory = func() (interface{}, error) { return net.Dial(network, address) }
+	closer  = func(i interface{}) error {
+		if v, ok := i.(net.Conn); ok {
+			return v.Close()
+		}
+		return nil
+	}
 )
 
 func init() {
@@ -339,3 +350,4407 @@ func TestChannelPool_Release(t *testing.T) {
 
 }
 
+func TestChannelPool_StatsGrowthEvents(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:     1,
+		MaxCap:         2,
+		Factory:        factory,
+		Close:          closer,
+		ConcurrentBase: 2,
+	})
+	defer p.Release()
+
+	if g := p.Stats().GrowthEvents; g != 0 {
+		t.Errorf("GrowthEvents was %d but should be 0", g)
+	}
+
+	// 第一个连接来自 InitialCap，不计入
+	c1, err := p.Get()
+	if err != nil {
+		t.Errorf("Get returned an error: %s", err.Error())
+	}
+	if g := p.Stats().GrowthEvents; g != 0 {
+		t.Errorf("GrowthEvents was %d but should be 0", g)
+	}
+
+	c2, err := p.Get()
+	if err != nil {
+		t.Errorf("Get returned an error: %s", err.Error())
+	}
+	c3, err := p.Get()
+	if err != nil {
+		t.Errorf("Get returned an error: %s", err.Error())
+	}
+	if g := p.Stats().GrowthEvents; g != 2 {
+		t.Errorf("GrowthEvents was %d but should be 2", g)
+	}
+
+	p.Put(c1)
+	p.Put(c2)
+	p.Put(c3)
+
+	// 复用空闲连接不计入
+	c4, _ := p.Get()
+	if g := p.Stats().GrowthEvents; g != 2 {
+		t.Errorf("GrowthEvents was %d but should be 2", g)
+	}
+	p.Put(c4)
+}
+
+func TestChannelPool_Watermark(t *testing.T) {
+	p, err := NewChannelPool(&Config{
+		InitialCap:     4,
+		MaxCap:         5,
+		Factory:        factory,
+		Close:          closer,
+		ConcurrentBase: 2,
+		LowWatermark:   2,
+		HighWatermark:  3,
+	})
+	if err != nil {
+		t.Fatalf("The pool returned an error: %s", err.Error())
+	}
+	defer p.Release()
+
+	// 取走 2 个后空闲连接数为 2，未低于 LowWatermark
+	var conns []*IdleConn
+	for i := 0; i < 2; i++ {
+		conn, err := p.Get()
+		if err != nil {
+			t.Errorf("Get returned an error: %s", err.Error())
+		}
+		conns = append(conns, conn)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if a := p.Len(); a != 2 {
+		t.Errorf("The pool available was %d but should be 2", a)
+	}
+
+	// 低于 LowWatermark，补充到 HighWatermark
+	conn, err := p.Get()
+	if err != nil {
+		t.Errorf("Get returned an error: %s", err.Error())
+	}
+	conns = append(conns, conn)
+
+	deadline := time.Now().Add(time.Second)
+	for p.Len() < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if a := p.Len(); a != 3 {
+		t.Errorf("The pool available was %d but should be 3", a)
+	}
+
+	for _, conn := range conns {
+		p.Put(conn)
+	}
+}
+
+func TestChannelPool_InvalidWatermark(t *testing.T) {
+	_, err := NewChannelPool(&Config{
+		InitialCap:    1,
+		MaxCap:        2,
+		Factory:       factory,
+		Close:         closer,
+		LowWatermark:  2,
+		HighWatermark: 3,
+	})
+	if err == nil {
+		t.Error("Expected an error for HighWatermark exceeding MaxCap")
+	}
+}
+
+func TestChannelPool_PutKeepWarm(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:  1,
+		MaxCap:      1,
+		Factory:     factory,
+		Close:       closer,
+		IdleTimeout: 100 * time.Millisecond,
+	})
+	defer p.Release()
+
+	wrapConn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get returned an error: %s", err.Error())
+	}
+	conn1, _ := wrapConn.Get()
+	if err := p.PutKeepWarm(wrapConn, 500*time.Millisecond); err != nil {
+		t.Errorf("PutKeepWarm returned an error: %s", err.Error())
+	}
+
+	// 超过 IdleTimeout 但未超过 keep warm 时间，连接应被复用
+	time.Sleep(200 * time.Millisecond)
+	wrapConn, err = p.Get()
+	if err != nil {
+		t.Fatalf("Get returned an error: %s", err.Error())
+	}
+	conn2, _ := wrapConn.Get()
+	if conn1 != conn2 {
+		t.Error("kept warm conn was evicted")
+	}
+
+	// 普通 Put 之后超过 IdleTimeout 应被丢弃
+	p.Put(wrapConn)
+	time.Sleep(200 * time.Millisecond)
+	wrapConn, err = p.Get()
+	if err != nil {
+		t.Fatalf("Get returned an error: %s", err.Error())
+	}
+	conn3, _ := wrapConn.Get()
+	if conn2 == conn3 {
+		t.Error("idle timed out conn was not evicted")
+	}
+	p.Put(wrapConn)
+}
+
+func TestChannelPool_GetReusesPutWhileWaiting(t *testing.T) {
+	var created int32
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     1,
+		Factory: func() (interface{}, error) {
+			atomic.AddInt32(&created, 1)
+			return factory()
+		},
+		Close:          closer,
+		PoolTimeout:    time.Second,
+		ConcurrentBase: 1,
+	})
+	defer p.Release()
+
+	wrapConn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get returned an error: %s", err.Error())
+	}
+	conn1, _ := wrapConn.Get()
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		p.Put(wrapConn)
+	}()
+
+	// queue 已满，等待期间放回的连接应被直接复用
+	wrapConn2, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get returned an error: %s", err.Error())
+	}
+	conn2, _ := wrapConn2.Get()
+	if conn1 != conn2 {
+		t.Error("waiting Get did not reuse the returned conn")
+	}
+	if n := atomic.LoadInt32(&created); n != 1 {
+		t.Errorf("Factory was called %d times but should be 1", n)
+	}
+	p.Put(wrapConn2)
+}
+
+func TestChannelPool_ResetForReuse(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:     2,
+		MaxCap:         2,
+		Factory:        factory,
+		Close:          closer,
+		ConcurrentBase: 2,
+	})
+	defer p.Release()
+	cp := p.(*channelPool)
+	idle := cp.getIdle()
+
+	for i := 0; i < 3; i++ {
+		c1, _ := p.Get()
+		c2, _ := p.Get()
+		c3, _ := p.Get()
+		c4, _ := p.Get()
+		p.TryGet()
+		p.Put(c1)
+		p.Put(c1)
+		p.Put(c2)
+		p.Close(c3)
+		p.Close(c4)
+		stats := p.Stats()
+		if stats.GrowthEvents == 0 || stats.Misses == 0 || stats.DoublePut == 0 || stats.Timeouts == 0 {
+			t.Errorf("The stats %+v should not be 0 before reset", stats)
+		}
+
+		p.ResetForReuse()
+
+		if a := p.Len(); a != 0 {
+			t.Errorf("The pool available was %d but should be 0", a)
+		}
+		stats = p.Stats()
+		if stats.GrowthEvents != 0 || stats.WaitCount != 0 || stats.WaitDuration != 0 || stats.DoublePut != 0 ||
+			stats.Hits != 0 || stats.Misses != 0 || stats.Timeouts != 0 {
+			t.Errorf("The stats %+v should be 0 after reset", stats)
+		}
+		if q := len(cp.getQueue()); q != 0 {
+			t.Errorf("The queue length was %d but should be 0", q)
+		}
+		if cp.getIdle() != idle {
+			t.Error("ResetForReuse reallocated the idle list")
+		}
+	}
+}
+
+func BenchmarkChannelPool_ResetForReuse(b *testing.B) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 0,
+		MaxCap:     4,
+		Factory:    func() (interface{}, error) { return struct{}{}, nil },
+		Close:      func(interface{}) error { return nil },
+	})
+	defer p.Release()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c1, _ := p.Get()
+		c2, _ := p.Get()
+		p.Put(c1)
+		p.Put(c2)
+		p.ResetForReuse()
+	}
+}
+
+func TestChannelPool_StrictConfig(t *testing.T) {
+	config := &Config{
+		InitialCap:         1,
+		MaxCap:             1,
+		Factory:            factory,
+		Close:              closer,
+		PoolTimeout:        0,
+		IdleCheckFrequency: -1,
+		ConcurrentBase:     1,
+		StrictConfig:       true,
+	}
+	if _, err := NewChannelPool(config); err == nil {
+		t.Error("Expected an error for zero PoolTimeout with StrictConfig")
+	}
+	if config.PoolTimeout != 0 {
+		t.Errorf("PoolTimeout was defaulted to %s", config.PoolTimeout)
+	}
+
+	config.PoolTimeout = time.Second
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatalf("The pool returned an error: %s", err.Error())
+	}
+	p.Release()
+}
+
+func TestChannelPool_AcquireInfo(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:     0,
+		MaxCap:         1,
+		Factory:        factory,
+		Close:          closer,
+		PoolTimeout:    time.Second,
+		ConcurrentBase: 1,
+	})
+	defer p.Release()
+
+	if _, ok := AcquireInfoFromContext(context.Background()); ok {
+		t.Error("AcquireInfo should not be present in a plain context")
+	}
+
+	ctx := WithAcquireInfo(context.Background())
+	if _, ok := AcquireInfoFromContext(ctx); ok {
+		t.Error("AcquireInfo should not be present before GetContext")
+	}
+
+	// 新建连接
+	wrapConn, err := p.GetContext(ctx)
+	if err != nil {
+		t.Fatalf("GetContext returned an error: %s", err.Error())
+	}
+	info, ok := AcquireInfoFromContext(ctx)
+	if !ok {
+		t.Fatal("AcquireInfo was not present after GetContext")
+	}
+	if !info.Fresh {
+		t.Error("AcquireInfo.Fresh should be true for a new conn")
+	}
+
+	// queue 已满，等待放回的连接
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		p.Put(wrapConn)
+	}()
+	ctx = WithAcquireInfo(context.Background())
+	wrapConn, err = p.GetContext(ctx)
+	if err != nil {
+		t.Fatalf("GetContext returned an error: %s", err.Error())
+	}
+	info, _ = AcquireInfoFromContext(ctx)
+	if info.Fresh {
+		t.Error("AcquireInfo.Fresh should be false for a reused conn")
+	}
+	if info.Duration < 100*time.Millisecond || info.Duration > time.Second {
+		t.Errorf("AcquireInfo.Duration was %s but should be about 100ms", info.Duration)
+	}
+	p.Put(wrapConn)
+}
+
+func TestChannelPool_AdaptiveTimeout(t *testing.T) {
+	p, err := NewChannelPool(&Config{
+		InitialCap:      0,
+		MaxCap:          1,
+		Factory:         factory,
+		Close:           closer,
+		PoolTimeout:     time.Second,
+		AdaptiveTimeout: true,
+		MinPoolTimeout:  50 * time.Millisecond,
+		MaxPoolTimeout:  2 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("The pool returned an error: %s", err.Error())
+	}
+	defer p.Release()
+	cp := p.(*channelPool)
+
+	// 没有数据时使用 PoolTimeout
+	if d := cp.currentPoolTimeout(); d != time.Second {
+		t.Errorf("The pool timeout was %s but should be 1s", d)
+	}
+
+	// 获取很快时收缩到 MinPoolTimeout
+	for i := 0; i < adaptiveWindowSize; i++ {
+		cp.latencies.record(time.Millisecond)
+	}
+	if d := cp.currentPoolTimeout(); d != 50*time.Millisecond {
+		t.Errorf("The pool timeout was %s but should be 50ms", d)
+	}
+
+	// 获取变慢时增大
+	for i := 0; i < adaptiveWindowSize; i++ {
+		cp.latencies.record(300 * time.Millisecond)
+	}
+	if d := cp.currentPoolTimeout(); d != 600*time.Millisecond {
+		t.Errorf("The pool timeout was %s but should be 600ms", d)
+	}
+
+	// 不超过 MaxPoolTimeout
+	for i := 0; i < adaptiveWindowSize; i++ {
+		cp.latencies.record(5 * time.Second)
+	}
+	if d := cp.currentPoolTimeout(); d != 2*time.Second {
+		t.Errorf("The pool timeout was %s but should be 2s", d)
+	}
+
+	// Get 记录耗时
+	wrapConn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get returned an error: %s", err.Error())
+	}
+	p.Put(wrapConn)
+	if cp.latencies.next != 1 {
+		t.Errorf("Get recorded %d latencies but should be 1", cp.latencies.next)
+	}
+}
+
+func TestChannelPool_InvalidAdaptiveTimeout(t *testing.T) {
+	_, err := NewChannelPool(&Config{
+		InitialCap:      0,
+		MaxCap:          1,
+		Factory:         factory,
+		Close:           closer,
+		AdaptiveTimeout: true,
+		MinPoolTimeout:  time.Second,
+		MaxPoolTimeout:  time.Millisecond,
+	})
+	if err == nil {
+		t.Error("Expected an error for MaxPoolTimeout less than MinPoolTimeout")
+	}
+}
+
+func TestChannelPool_Quiesce(t *testing.T) {
+	var created int32
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 3,
+		MaxCap:     3,
+		Factory: func() (interface{}, error) {
+			atomic.AddInt32(&created, 1)
+			return factory()
+		},
+		Close: closer,
+	})
+
+	wrapConn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get returned an error: %s", err.Error())
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		done <- p.Quiesce(ctx)
+	}()
+
+	// 空闲连接逐渐减少到 0
+	last := p.Len()
+	deadline := time.Now().Add(time.Second)
+	for p.Len() > 0 && time.Now().Before(deadline) {
+		if a := p.Len(); a > last {
+			t.Errorf("The pool available grew from %d to %d", last, a)
+		}
+		last = p.Len()
+		time.Sleep(5 * time.Millisecond)
+	}
+	if a := p.Len(); a != 0 {
+		t.Errorf("The pool available was %d but should be 0", a)
+	}
+
+	if _, err := p.Get(); err != ErrPoolClosed {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrPoolClosed.Error(), err)
+	}
+
+	select {
+	case err := <-done:
+		t.Errorf("Quiesce returned %v before the borrowed conn was put", err)
+	default:
+	}
+
+	p.Put(wrapConn)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Quiesce returned an error: %s", err.Error())
+		}
+	case <-time.After(time.Second):
+		t.Error("Quiesce did not return after the borrowed conn was put")
+	}
+
+	if a := p.Len(); a != 0 {
+		t.Errorf("The pool available was %d but should be 0", a)
+	}
+
+	if n := atomic.LoadInt32(&created); n != 3 {
+		t.Errorf("Factory was called %d times but should be 3", n)
+	}
+
+	// 同 Release，Quiesce 之后连接池恢复可用
+	wrapConn, err = p.Get()
+	if err != nil {
+		t.Fatalf("Get after Quiesce returned an error: %s", err.Error())
+	}
+	p.Put(wrapConn)
+}
+
+func TestChannelPool_PingError(t *testing.T) {
+	errPing := errors.New("ping failed")
+	var failing int32
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     1,
+		Factory:    factory,
+		Close:      closer,
+		Ping: func(interface{}) error {
+			if atomic.LoadInt32(&failing) == 1 {
+				return errPing
+			}
+			return nil
+		},
+	})
+	defer p.Release()
+
+	wrapConn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get returned an error: %s", err.Error())
+	}
+	id, err := wrapConn.ID()
+	if err != nil || id == 0 {
+		t.Errorf("ID returned %d, %v", id, err)
+	}
+	if err := p.Ping(wrapConn); err != nil {
+		t.Errorf("Ping returned an error: %s", err.Error())
+	}
+
+	atomic.StoreInt32(&failing, 1)
+	err = p.Ping(wrapConn)
+	var pingErr *PingError
+	if !errors.As(err, &pingErr) {
+		t.Fatalf("Expected a *PingError but got \"%v\"", err)
+	}
+	if pingErr.ConnID != id {
+		t.Errorf("PingError.ConnID was %d but should be %d", pingErr.ConnID, id)
+	}
+	if pingErr.Age <= 0 {
+		t.Errorf("PingError.Age was %s but should be positive", pingErr.Age)
+	}
+	if !errors.Is(err, errPing) {
+		t.Errorf("PingError does not unwrap to the ping error")
+	}
+	p.Close(wrapConn)
+}
+
+type testLogger struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	l.logs = append(l.logs, fmt.Sprintf(format, v...))
+	l.mu.Unlock()
+}
+
+func (l *testLogger) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.logs)
+}
+
+func TestChannelPool_ReleaseCloseTimeout(t *testing.T) {
+	var created, slowClosed int32
+	logger := &testLogger{}
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 3,
+		MaxCap:     3,
+		Factory: func() (interface{}, error) {
+			return atomic.AddInt32(&created, 1), nil
+		},
+		Close: func(i interface{}) error {
+			if i.(int32) == 1 {
+				time.Sleep(500 * time.Millisecond)
+				atomic.StoreInt32(&slowClosed, 1)
+			}
+			return nil
+		},
+		ReleaseCloseTimeout: 50 * time.Millisecond,
+		Logger:              logger,
+	})
+
+	start := time.Now()
+	p.Release()
+	if d := time.Since(start); d > 300*time.Millisecond {
+		t.Errorf("Release took %s but should return after about 50ms", d)
+	}
+	if atomic.LoadInt32(&slowClosed) != 0 {
+		t.Error("slow close finished before Release returned")
+	}
+	if logger.Len() != 1 {
+		t.Errorf("Release logged %d messages but should be 1", logger.Len())
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&slowClosed) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&slowClosed) != 1 {
+		t.Error("slow close did not finish in background")
+	}
+}
+
+func TestChannelPool_IdleCheck(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:         2,
+		MaxCap:             2,
+		Factory:            factory,
+		Close:              closer,
+		IdleTimeout:        100 * time.Millisecond,
+		IdleCheckFrequency: 50 * time.Millisecond,
+	})
+	defer p.Release()
+	cp := p.(*channelPool)
+
+	if a := p.Len(); a != 2 {
+		t.Errorf("The pool available was %d but should be 2", a)
+	}
+
+	// 不调用 Get，空闲连接也会被清理
+	time.Sleep(300 * time.Millisecond)
+	if a := p.Len(); a != 0 {
+		t.Errorf("The pool available was %d but should be 0", a)
+	}
+	if q := len(cp.getQueue()); q != 0 {
+		t.Errorf("The queue length was %d but should be 0", q)
+	}
+}
+
+func TestChannelPool_IdleCheckDisabled(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:         2,
+		MaxCap:             2,
+		Factory:            factory,
+		Close:              closer,
+		IdleTimeout:        50 * time.Millisecond,
+		IdleCheckFrequency: -1,
+	})
+	defer p.Release()
+
+	time.Sleep(150 * time.Millisecond)
+	if a := p.Len(); a != 2 {
+		t.Errorf("The pool available was %d but should be 2", a)
+	}
+}
+
+func TestChannelPool_GetContext(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:     1,
+		MaxCap:         1,
+		Factory:        factory,
+		Close:          closer,
+		PoolTimeout:    3 * time.Second,
+		ConcurrentBase: 1,
+	})
+	defer p.Release()
+	cp := p.(*channelPool)
+
+	wrapConn, err := p.GetContext(context.Background())
+	if err != nil {
+		t.Fatalf("GetContext returned an error: %s", err.Error())
+	}
+
+	// 连接池已满，ctx 超时早于 PoolTimeout
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = p.GetContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", context.DeadlineExceeded.Error(), err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("GetContext took %s but should return after about 100ms", d)
+	}
+
+	// 已取消的 ctx 直接返回
+	p.Put(wrapConn)
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.GetContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", context.Canceled.Error(), err)
+	}
+	if a := p.Len(); a != 1 {
+		t.Errorf("The pool available was %d but should be 1", a)
+	}
+	if q := len(cp.getQueue()); q != 1 {
+		t.Errorf("The queue length was %d but should be 1", q)
+	}
+}
+
+func TestChannelPool_GetContextCancelDuringFactory(t *testing.T) {
+	var closed int32
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 0,
+		MaxCap:     1,
+		Factory: func() (interface{}, error) {
+			time.Sleep(200 * time.Millisecond)
+			return struct{}{}, nil
+		},
+		Close: func(interface{}) error {
+			atomic.AddInt32(&closed, 1)
+			return nil
+		},
+	})
+	defer p.Release()
+	cp := p.(*channelPool)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	if _, err := p.GetContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", context.Canceled.Error(), err)
+	}
+	if q := len(cp.getQueue()); q != 0 {
+		t.Errorf("The queue length was %d but should be 0", q)
+	}
+	if n := atomic.LoadInt32(&closed); n != 1 {
+		t.Errorf("Close was called %d times but should be 1", n)
+	}
+}
+
+func TestChannelPool_Tags(t *testing.T) {
+	var created int32
+	p, err := NewChannelPool(&Config{
+		InitialCap: 3,
+		MaxCap:     3,
+		TagFactory: func() (interface{}, string, error) {
+			conn, err := factory()
+			if atomic.AddInt32(&created, 1)%2 == 0 {
+				return conn, "replica", err
+			}
+			return conn, "primary", err
+		},
+		Close: closer,
+	})
+	if err != nil {
+		t.Fatalf("The pool returned an error: %s", err.Error())
+	}
+	defer p.Release()
+
+	byTag := p.Stats().IdleByTag
+	if byTag["primary"] != 2 || byTag["replica"] != 1 {
+		t.Errorf("IdleByTag was %v but should be map[primary:2 replica:1]", byTag)
+	}
+
+	dumped := make(map[uint64]string)
+	for _, info := range p.Dump() {
+		dumped[info.ID] = info.Tag
+	}
+	if len(dumped) != 3 {
+		t.Errorf("Dump returned %d conns but should be 3", len(dumped))
+	}
+
+	// 取出后标签不变，放回后仍可见
+	wrapConn, _ := p.Get()
+	id, _ := wrapConn.ID()
+	tag, err := wrapConn.Tag()
+	if err != nil || tag != dumped[id] {
+		t.Errorf("Tag was %q, %v but should be %q", tag, err, dumped[id])
+	}
+	p.Put(wrapConn)
+
+	for _, info := range p.Dump() {
+		if info.Tag != dumped[info.ID] {
+			t.Errorf("Dump tag of conn %d was %q but should be %q", info.ID, info.Tag, dumped[info.ID])
+		}
+	}
+	if byTag := p.Stats().IdleByTag; byTag["primary"] != 2 || byTag["replica"] != 1 {
+		t.Errorf("IdleByTag was %v but should be map[primary:2 replica:1]", byTag)
+	}
+}
+
+func TestChannelPool_RecreateByID(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:     3,
+		MaxCap:         3,
+		Factory:        factory,
+		Close:          closer,
+		ConcurrentBase: 1,
+	})
+	defer p.Release()
+
+	idleIDs := func() map[uint64]bool {
+		ids := make(map[uint64]bool)
+		for _, info := range p.Dump() {
+			ids[info.ID] = true
+		}
+		return ids
+	}
+
+	before := idleIDs()
+	var target uint64
+	for id := range before {
+		target = id
+		break
+	}
+
+	newID, err := p.RecreateByID(target)
+	if err != nil {
+		t.Fatalf("RecreateByID returned an error: %s", err.Error())
+	}
+	if newID == 0 || before[newID] {
+		t.Errorf("RecreateByID returned id %d which is not new", newID)
+	}
+
+	after := idleIDs()
+	if len(after) != 3 || after[target] || !after[newID] {
+		t.Errorf("The idle ids were %v after recreating %d as %d", after, target, newID)
+	}
+	for id := range before {
+		if id != target && !after[id] {
+			t.Errorf("conn %d was disturbed", id)
+		}
+	}
+
+	// 已取出的连接放回时替换
+	wrapConn, _ := p.Get()
+	id, _ := wrapConn.ID()
+	conn, _ := wrapConn.Get()
+	if newID, err := p.RecreateByID(id); newID != 0 || err != nil {
+		t.Errorf("RecreateByID returned %d, %v for a checked out conn", newID, err)
+	}
+	if err := p.Put(wrapConn); err != nil {
+		t.Errorf("Put returned an error: %s", err.Error())
+	}
+	if ids := idleIDs(); len(ids) != 3 || ids[id] {
+		t.Errorf("The idle ids were %v after putting marked conn %d", ids, id)
+	}
+	if _, err := conn.(net.Conn).Write([]byte("x")); err == nil {
+		t.Error("marked conn was not closed")
+	}
+
+	// 已关闭或不存在的连接不标记
+	if newID, err := p.RecreateByID(id); newID != 0 || err != ErrConnClosed {
+		t.Errorf("RecreateByID returned %d, %v for a closed conn", newID, err)
+	}
+	if n := len(p.(*channelPool).recreateIDs); n != 0 {
+		t.Errorf("%d recreate marks were left but should be 0", n)
+	}
+}
+
+func TestChannelPool_RecreateByIDAfterClose(t *testing.T) {
+	factory, closer, stats := NewMockFactory()
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     1,
+		Factory:    factory,
+		Close:      closer,
+	})
+
+	wrapConn, _ := p.Get()
+	id, _ := wrapConn.ID()
+	if _, err := p.RecreateByID(id); err != nil {
+		t.Fatalf("RecreateByID returned an error: %s", err.Error())
+	}
+	p.ClosePool()
+
+	// 连接池已关闭，放回时直接关闭而不新建连接
+	p.Put(wrapConn)
+	if n := stats.Created(); n != 1 {
+		t.Errorf("%d conns were created but should be 1", n)
+	}
+	if n := stats.Open(); n != 0 {
+		t.Errorf("%d conns were still open but should be 0", n)
+	}
+	if n := len(p.(*channelPool).recreateIDs); n != 0 {
+		t.Errorf("%d recreate marks were left but should be 0", n)
+	}
+}
+
+func TestChannelPool_ClosePool(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 2,
+		MaxCap:     3,
+		Factory:    factory,
+		Close:      closer,
+	})
+
+	c1, _ := p.Get()
+	c2, _ := p.Get()
+	raw1, _ := c1.Get()
+
+	if err := p.ClosePool(); err != nil {
+		t.Errorf("ClosePool returned an error: %s", err.Error())
+	}
+	if a := p.Len(); a != 0 {
+		t.Errorf("The pool available was %d but should be 0", a)
+	}
+
+	if _, err := p.Get(); err != ErrPoolClosed {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrPoolClosed.Error(), err)
+	}
+	if err := p.Put(c1); err != ErrPoolClosed {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrPoolClosed.Error(), err)
+	}
+	if _, err := raw1.(net.Conn).Write([]byte("x")); err == nil {
+		t.Error("conn put after ClosePool was not closed")
+	}
+	if err := p.Close(c2); err != ErrPoolClosed {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrPoolClosed.Error(), err)
+	}
+
+	// Release 和重复 ClosePool 不做任何处理
+	p.Release()
+	if _, err := p.Get(); err != ErrPoolClosed {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrPoolClosed.Error(), err)
+	}
+	if err := p.ClosePool(); err != nil {
+		t.Errorf("ClosePool returned an error: %s", err.Error())
+	}
+	if q := len(p.(*channelPool).getQueue()); q != 0 {
+		t.Errorf("The queue length was %d but should be 0", q)
+	}
+}
+
+func TestChannelPool_MaxPingAttemptsPerGet(t *testing.T) {
+	var pinged int32
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 3,
+		MaxCap:     3,
+		Factory:    factory,
+		Close:      closer,
+		Ping: func(interface{}) error {
+			atomic.AddInt32(&pinged, 1)
+			return errors.New("dead conn")
+		},
+		ConcurrentBase:        1,
+		MaxPingAttemptsPerGet: 1,
+	})
+	defer p.Release()
+
+	// 空闲连接都已失效，只检查一条后直接新建
+	wrapConn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get returned an error: %s", err.Error())
+	}
+	if !wrapConn.fresh {
+		t.Error("Get should return a fresh conn")
+	}
+	if n := atomic.LoadInt32(&pinged); n != 1 {
+		t.Errorf("Ping was called %d times but should be 1", n)
+	}
+	if a := p.Len(); a != 2 {
+		t.Errorf("The pool available was %d but should be 2", a)
+	}
+	p.Close(wrapConn)
+}
+
+func TestChannelPool_ConcurrentRelease(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:  2,
+		MaxCap:      4,
+		Factory:     func() (interface{}, error) { return struct{}{}, nil },
+		Close:       func(interface{}) error { return nil },
+		PoolTimeout: 100 * time.Millisecond,
+	})
+	defer p.Release()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				wrapConn, err := p.Get()
+				if err != nil {
+					if err != ErrPoolTimeout {
+						t.Errorf("Get returned an error: %s", err.Error())
+					}
+					continue
+				}
+				p.Put(wrapConn)
+			}
+		}()
+	}
+
+	for i := 0; i < 50; i++ {
+		p.Release()
+		time.Sleep(time.Millisecond)
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func BenchmarkChannelPool_GetPut(b *testing.B) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 8,
+		MaxCap:     8,
+		Factory:    func() (interface{}, error) { return struct{}{}, nil },
+		Close:      func(interface{}) error { return nil },
+	})
+	defer p.Release()
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			wrapConn, err := p.Get()
+			if err != nil {
+				continue
+			}
+			p.Put(wrapConn)
+		}
+	})
+}
+
+func TestChannelPool_MaxConnLifetime(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:      1,
+		MaxCap:          1,
+		Factory:         factory,
+		Close:           closer,
+		MaxConnLifetime: 2 * time.Second,
+	})
+	defer p.Release()
+
+	wrapConn, _ := p.Get()
+	conn1, _ := wrapConn.Get()
+	p.Put(wrapConn)
+
+	// 未超过存活时间，复用原连接
+	wrapConn, _ = p.Get()
+	conn2, _ := wrapConn.Get()
+	if conn1 != conn2 {
+		t.Error("conn was replaced before MaxConnLifetime")
+	}
+	p.Put(wrapConn)
+
+	time.Sleep(2*time.Second + 100*time.Millisecond)
+
+	wrapConn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get returned an error: %s", err.Error())
+	}
+	conn3, _ := wrapConn.Get()
+	if conn1 == conn3 {
+		t.Error("conn was not replaced after MaxConnLifetime")
+	}
+	p.Put(wrapConn)
+}
+
+func TestChannelPool_MinIdle(t *testing.T) {
+	p, err := NewChannelPool(&Config{
+		InitialCap:            2,
+		MaxCap:                3,
+		Factory:               factory,
+		Close:                 closer,
+		MinIdle:               2,
+		MinIdleCheckFrequency: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("The pool returned an error: %s", err.Error())
+	}
+	defer p.Release()
+
+	c1, _ := p.Get()
+	c2, _ := p.Get()
+	if a := p.Len(); a != 0 {
+		t.Errorf("The pool available was %d but should be 0", a)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for p.Len() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if a := p.Len(); a != 2 {
+		t.Errorf("The pool available was %d but should be 2", a)
+	}
+
+	p.Put(c1)
+	p.Put(c2)
+}
+
+func TestChannelPool_ReleaseRestartsBackground(t *testing.T) {
+	factory, closer, _ := NewMockFactory()
+	p, err := NewChannelPool(&Config{
+		InitialCap:            0,
+		MaxCap:                3,
+		Factory:               factory,
+		Close:                 closer,
+		MinIdle:               2,
+		MinIdleCheckFrequency: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewChannelPool error: %s", err)
+	}
+	defer p.ClosePool()
+
+	p.Release()
+	deadline := time.Now().Add(time.Second)
+	for p.Len() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if a := p.Len(); a != 2 {
+		t.Errorf("The pool available was %d after Release but should be 2", a)
+	}
+
+	factory, closer, _ = NewMockFactory()
+	p, err = NewChannelPool(&Config{
+		InitialCap:         0,
+		MaxCap:             3,
+		Factory:            factory,
+		Close:              closer,
+		IdleTimeout:        20 * time.Millisecond,
+		IdleCheckFrequency: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewChannelPool error: %s", err)
+	}
+	defer p.ClosePool()
+
+	p.Release()
+	wrapConn, _ := p.Get()
+	p.Put(wrapConn)
+	deadline = time.Now().Add(time.Second)
+	for p.Len() != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if a := p.Len(); a != 0 {
+		t.Errorf("The pool available was %d after Release but should be 0", a)
+	}
+}
+
+func TestChannelPool_InvalidMinIdle(t *testing.T) {
+	_, err := NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     2,
+		Factory:    factory,
+		Close:      closer,
+		MinIdle:    3,
+	})
+	if err == nil {
+		t.Error("Expected an error for MinIdle exceeding MaxCap")
+	}
+}
+
+func TestChannelPool_OnReuse(t *testing.T) {
+	var reused int32
+	var idleFor time.Duration
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     2,
+		Factory:    factory,
+		Close:      closer,
+		OnReuse: func(conn interface{}, d time.Duration) {
+			atomic.AddInt32(&reused, 1)
+			idleFor = d
+		},
+	})
+	defer p.Release()
+
+	time.Sleep(20 * time.Millisecond)
+	c1, _ := p.Get()
+	if n := atomic.LoadInt32(&reused); n != 1 {
+		t.Errorf("OnReuse was called %d times but should be 1", n)
+	}
+	if idleFor < 20*time.Millisecond {
+		t.Errorf("OnReuse idleFor was %s but should be at least 20ms", idleFor)
+	}
+
+	// 新建的连接不调用
+	c2, _ := p.Get()
+	if n := atomic.LoadInt32(&reused); n != 1 {
+		t.Errorf("OnReuse was called %d times but should be 1", n)
+	}
+
+	p.Put(c1)
+	p.Put(c2)
+}
+
+func TestChannelPool_ShutdownOrdering(t *testing.T) {
+	var created int32
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 2,
+		MaxCap:     4,
+		Factory: func() (interface{}, error) {
+			atomic.AddInt32(&created, 1)
+			return struct{}{}, nil
+		},
+		Close:                 func(interface{}) error { return nil },
+		IdleTimeout:           5 * time.Millisecond,
+		IdleCheckFrequency:    time.Millisecond,
+		LowWatermark:          2,
+		HighWatermark:         3,
+		MinIdle:               3,
+		MinIdleCheckFrequency: time.Millisecond,
+	})
+	cp := p.(*channelPool)
+
+	// 后台 goroutine 不断清理和补充连接
+	for i := 0; i < 20; i++ {
+		if wrapConn, err := p.Get(); err == nil {
+			p.Put(wrapConn)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := p.ClosePool(); err != nil {
+		t.Errorf("ClosePool returned an error: %s", err.Error())
+	}
+
+	// 后台 goroutine 已全部退出，不再创建连接
+	n := atomic.LoadInt32(&created)
+	time.Sleep(20 * time.Millisecond)
+	if m := atomic.LoadInt32(&created); m != n {
+		t.Errorf("Factory was called %d times after ClosePool", m-n)
+	}
+	if q := len(cp.getQueue()); q != 0 {
+		t.Errorf("The queue length was %d but should be 0", q)
+	}
+}
+
+func TestChannelPool_PingOnPut(t *testing.T) {
+	var failing, closed int32
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 0,
+		MaxCap:     2,
+		Factory:    func() (interface{}, error) { return struct{}{}, nil },
+		Close: func(interface{}) error {
+			atomic.AddInt32(&closed, 1)
+			return nil
+		},
+		Ping: func(interface{}) error {
+			if atomic.LoadInt32(&failing) == 1 {
+				return errors.New("broken conn")
+			}
+			return nil
+		},
+		PingOnPut: true,
+	})
+	defer p.Release()
+	cp := p.(*channelPool)
+
+	wrapConn, _ := p.Get()
+	if err := p.Put(wrapConn); err != nil {
+		t.Errorf("Put returned an error: %s", err.Error())
+	}
+	if a := p.Len(); a != 1 {
+		t.Errorf("The pool available was %d but should be 1", a)
+	}
+
+	// Ping 失败的连接被关闭，不放回 pool
+	wrapConn, _ = p.Get()
+	atomic.StoreInt32(&failing, 1)
+	if err := p.Put(wrapConn); err != nil {
+		t.Errorf("Put returned an error: %s", err.Error())
+	}
+	if a := p.Len(); a != 0 {
+		t.Errorf("The pool available was %d but should be 0", a)
+	}
+	if n := atomic.LoadInt32(&closed); n != 1 {
+		t.Errorf("Close was called %d times but should be 1", n)
+	}
+	if q := len(cp.getQueue()); q != 0 {
+		t.Errorf("The queue length was %d but should be 0", q)
+	}
+}
+
+func TestChannelPool_TryGet(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:     1,
+		MaxCap:         2,
+		Factory:        factory,
+		Close:          closer,
+		PoolTimeout:    3 * time.Second,
+		ConcurrentBase: 1,
+	})
+	defer p.Release()
+
+	c1, err := p.TryGet()
+	if err != nil || c1.fresh {
+		t.Errorf("TryGet should reuse the idle conn, got fresh=%v err=%v", c1 != nil && c1.fresh, err)
+	}
+	c2, err := p.TryGet()
+	if err != nil || !c2.fresh {
+		t.Errorf("TryGet should create a new conn, got err=%v", err)
+	}
+
+	// 连接池已满，立即返回
+	start := time.Now()
+	if _, err := p.TryGet(); err != ErrPoolTimeout {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrPoolTimeout.Error(), err)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("TryGet took %s but should not block", d)
+	}
+
+	p.Put(c1)
+	p.Put(c2)
+}
+
+func TestChannelPool_ExpiryGrace(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:  1,
+		MaxCap:      1,
+		Factory:     factory,
+		Close:       closer,
+		IdleTimeout: 300 * time.Millisecond,
+		ExpiryGrace: 200 * time.Millisecond,
+	})
+	defer p.Release()
+
+	wrapConn, _ := p.Get()
+	conn1, _ := wrapConn.Get()
+	p.Put(wrapConn)
+
+	// 距离超时还很远，复用原连接
+	wrapConn, _ = p.Get()
+	conn2, _ := wrapConn.Get()
+	if conn1 != conn2 {
+		t.Error("conn far from expiry was not reused")
+	}
+	p.Put(wrapConn)
+
+	// 未超过 IdleTimeout 但已进入 ExpiryGrace，新建连接
+	time.Sleep(150 * time.Millisecond)
+	wrapConn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get returned an error: %s", err.Error())
+	}
+	conn3, _ := wrapConn.Get()
+	if conn1 == conn3 || !wrapConn.fresh {
+		t.Error("near-expiry conn was handed out")
+	}
+	p.Put(wrapConn)
+}
+
+func TestChannelPool_DOT(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 2,
+		MaxCap:     3,
+		Factory:    factory,
+		Close:      closer,
+	})
+	defer p.Release()
+
+	wrapConn, _ := p.Get()
+	defer p.Put(wrapConn)
+	id, _ := wrapConn.ID()
+
+	dot := p.DOT()
+	if !strings.HasPrefix(dot, "digraph pool {") {
+		t.Errorf("DOT output is not a digraph: %s", dot)
+	}
+	for _, info := range p.Dump() {
+		node := fmt.Sprintf("conn%d [label=\"#%d idle", info.ID, info.ID)
+		if !strings.Contains(dot, node) {
+			t.Errorf("DOT output has no node for conn %d: %s", info.ID, dot)
+		}
+	}
+	if node := fmt.Sprintf("conn%d [label=\"#%d in use\"", id, id); !strings.Contains(dot, node) {
+		t.Errorf("DOT output has no node for in use conn %d: %s", id, dot)
+	}
+
+	now := time.Now()
+	dot = renderDOT([]ConnInfo{{ID: 7, Tag: `a"b`, CreatedAt: now.Add(-time.Second), LastUsed: now}}, []uint64{9}, now)
+	want := "digraph pool {\n" +
+		"\tpool [shape=box, label=\"pool\\nidle=1\\nin_use=1\"];\n" +
+		"\tconn7 [label=\"#7 idle\\nage 1s\\nidle 0s\\ntag a\\\"b\"];\n" +
+		"\tpool -> conn7;\n" +
+		"\tconn9 [label=\"#9 in use\", style=dashed];\n" +
+		"\tpool -> conn9 [style=dashed];\n" +
+		"}\n"
+	if dot != want {
+		t.Errorf("unexpected DOT output:\n%s\nwant:\n%s", dot, want)
+	}
+}
+
+func TestChannelPool_QueueBalance(t *testing.T) {
+	var closed int32
+	p, _ := NewChannelPool(&Config{
+		InitialCap:     2,
+		MaxCap:         2,
+		Factory:        func() (interface{}, error) { return struct{}{}, nil },
+		Close:          func(interface{}) error { atomic.AddInt32(&closed, 1); return nil },
+		IdleTimeout:    time.Millisecond,
+		PoolTimeout:    100 * time.Millisecond,
+		ConcurrentBase: 2,
+	})
+	defer p.Release()
+	cp := p.(*channelPool)
+
+	for i := 0; i < 200; i++ {
+		// 空闲连接已超时，取出时被丢弃并新建；第 3 个连接放回时 pool 已满被关闭
+		time.Sleep(2 * time.Millisecond)
+		var conns []*IdleConn
+		for j := 0; j < 3; j++ {
+			wrapConn, err := p.Get()
+			if err != nil {
+				t.Fatalf("Get returned an error on round %d: %s", i, err.Error())
+			}
+			conns = append(conns, wrapConn)
+		}
+		for _, wrapConn := range conns {
+			p.Put(wrapConn)
+		}
+
+		if q, a := len(cp.getQueue()), p.Len(); q != a {
+			t.Fatalf("The queue length was %d but should equal the idle count %d", q, a)
+		}
+	}
+
+	p.ResetForReuse()
+	if q := len(cp.getQueue()); q != 0 {
+		t.Errorf("The queue length was %d but should be 0", q)
+	}
+}
+
+type closerConn struct {
+	closed int32
+}
+
+func (c *closerConn) Close() error {
+	atomic.AddInt32(&c.closed, 1)
+	return nil
+}
+
+func TestChannelPool_DefaultCloseViaIOCloser(t *testing.T) {
+	var conns []*closerConn
+	p, err := NewChannelPool(&Config{
+		InitialCap: 2,
+		MaxCap:     2,
+		Factory: func() (interface{}, error) {
+			conn := &closerConn{}
+			conns = append(conns, conn)
+			return conn, nil
+		},
+		DefaultCloseViaIOCloser: true,
+	})
+	if err != nil {
+		t.Fatalf("The pool returned an error: %s", err.Error())
+	}
+
+	wrapConn, _ := p.Get()
+	p.Close(wrapConn)
+	p.Release()
+	for i, conn := range conns {
+		if n := atomic.LoadInt32(&conn.closed); n != 1 {
+			t.Errorf("conn %d was closed %d times but should be 1", i, n)
+		}
+	}
+
+	// 连接未实现 io.Closer 时初始化失败
+	_, err = NewChannelPool(&Config{
+		InitialCap:              1,
+		MaxCap:                  1,
+		Factory:                 func() (interface{}, error) { return struct{}{}, nil },
+		DefaultCloseViaIOCloser: true,
+	})
+	if !errors.Is(err, ErrConnNotCloser) {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrConnNotCloser.Error(), err)
+	}
+
+	// 未设置 DefaultCloseViaIOCloser 时 Close 不能为 nil
+	_, err = NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     1,
+		Factory:    func() (interface{}, error) { return &closerConn{}, nil },
+	})
+	if err == nil {
+		t.Error("Expected an error for nil Close")
+	}
+}
+
+func TestChannelPool_ReapNow(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:         0,
+		MaxCap:             2,
+		Factory:            factory,
+		Close:              closer,
+		IdleTimeout:        50 * time.Millisecond,
+		IdleCheckFrequency: -1,
+	})
+	defer p.Release()
+
+	c1, _ := p.Get()
+	c2, _ := p.Get()
+	p.Put(c1)
+	if n := p.ReapNow(); n != 0 {
+		t.Errorf("ReapNow evicted %d conns but should be 0", n)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	p.Put(c2)
+	if n := p.ReapNow(); n != 1 {
+		t.Errorf("ReapNow evicted %d conns but should be 1", n)
+	}
+	if a := p.Len(); a != 1 {
+		t.Errorf("The pool available was %d but should be 1", a)
+	}
+}
+
+func TestChannelPool_PoolFIFO(t *testing.T) {
+	for _, fifo := range []bool{false, true} {
+		p, _ := NewChannelPool(&Config{
+			InitialCap: 0,
+			MaxCap:     3,
+			Factory:    factory,
+			Close:      closer,
+			PoolFIFO:   fifo,
+		})
+
+		var ids []uint64
+		var conns []*IdleConn
+		for i := 0; i < 3; i++ {
+			wrapConn, _ := p.Get()
+			id, _ := wrapConn.ID()
+			ids = append(ids, id)
+			conns = append(conns, wrapConn)
+		}
+		for _, wrapConn := range conns {
+			p.Put(wrapConn)
+		}
+
+		for i := 0; i < 3; i++ {
+			want := ids[len(ids)-1-i]
+			if fifo {
+				want = ids[i]
+			}
+			wrapConn, _ := p.Get()
+			if id, _ := wrapConn.ID(); id != want {
+				t.Errorf("PoolFIFO %v: Get returned conn %d but should be %d", fifo, id, want)
+			}
+		}
+		p.Release()
+	}
+}
+
+func TestChannelPool_WaitStats(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:     1,
+		MaxCap:         1,
+		ConcurrentBase: 1,
+		Factory:        factory,
+		Close:          closer,
+	})
+	defer p.Release()
+
+	c1, _ := p.Get()
+	if s := p.Stats(); s.WaitCount != 0 {
+		t.Errorf("WaitCount was %d but should be 0", s.WaitCount)
+	}
+
+	blocked := 100 * time.Millisecond
+	go func() {
+		time.Sleep(blocked)
+		p.Put(c1)
+	}()
+
+	c2, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	defer p.Put(c2)
+
+	s := p.Stats()
+	if s.WaitCount != 1 {
+		t.Errorf("WaitCount was %d but should be 1", s.WaitCount)
+	}
+	if s.WaitDuration < blocked/2 || s.WaitDuration > 5*blocked {
+		t.Errorf("WaitDuration was %s but should be about %s", s.WaitDuration, blocked)
+	}
+}
+
+func TestChannelPool_Context(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 2,
+		MaxCap:     2,
+		Factory:    factory,
+		Close:      closer,
+		Context:    ctx,
+	})
+
+	if _, err := p.Get(); err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for p.Len() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := p.Get(); err != ErrPoolClosed {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrPoolClosed, err)
+	}
+}
+
+func TestChannelPool_OnClose(t *testing.T) {
+	var mu sync.Mutex
+	var reasons []CloseReason
+	p, _ := NewChannelPool(&Config{
+		InitialCap:         0,
+		MaxCap:             1,
+		ConcurrentBase:     2,
+		Factory:            factory,
+		Close:              closer,
+		IdleTimeout:        50 * time.Millisecond,
+		IdleCheckFrequency: -1,
+		OnClose: func(conn interface{}, reason CloseReason) {
+			mu.Lock()
+			reasons = append(reasons, reason)
+			mu.Unlock()
+		},
+	})
+	defer p.Release()
+
+	c1, _ := p.Get()
+	c2, _ := p.Get()
+	p.Put(c1)
+	p.Put(c2)
+	mu.Lock()
+	if len(reasons) != 1 || reasons[0] != ReasonPoolFull {
+		t.Errorf("OnClose reasons were %v but should be [%s]", reasons, ReasonPoolFull)
+	}
+	reasons = nil
+	mu.Unlock()
+
+	time.Sleep(100 * time.Millisecond)
+	p.ReapNow()
+	mu.Lock()
+	if len(reasons) != 1 || reasons[0] != ReasonIdle {
+		t.Errorf("OnClose reasons were %v but should be [%s]", reasons, ReasonIdle)
+	}
+	mu.Unlock()
+}
+
+func TestChannelPool_AddrOf(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     1,
+		Factory:    factory,
+		Close:      closer,
+		AddrOf: func(conn interface{}) string {
+			return conn.(net.Conn).RemoteAddr().String()
+		},
+	})
+	defer p.Release()
+
+	infos := p.Dump()
+	if len(infos) != 1 {
+		t.Fatalf("Dump returned %d conns but should be 1", len(infos))
+	}
+	if infos[0].Addr != address {
+		t.Errorf("The cached addr was %q but should be %q", infos[0].Addr, address)
+	}
+	if dot := p.DOT(); !strings.Contains(dot, "addr "+address) {
+		t.Errorf("DOT output %q does not contain the cached addr", dot)
+	}
+}
+
+func TestChannelPool_ConnectRetries(t *testing.T) {
+	var calls int32
+	flaky := func() (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			return nil, errors.New("backend unavailable")
+		}
+		return factory()
+	}
+
+	p, _ := NewChannelPool(&Config{
+		InitialCap:          0,
+		MaxCap:              1,
+		Factory:             flaky,
+		Close:               closer,
+		ConnectRetries:      2,
+		ConnectRetryBackoff: 10 * time.Millisecond,
+	})
+	defer p.Release()
+
+	wrapConn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	p.Put(wrapConn)
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("The factory was called %d times but should be 3", n)
+	}
+
+	// 重试次数用完后返回 ErrConnGenerateFailed
+	atomic.StoreInt32(&calls, -10)
+	p.Release()
+	if _, err := p.Get(); !errors.Is(err, ErrConnGenerateFailed) {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrConnGenerateFailed, err)
+	}
+}
+
+type recordBackoff struct {
+	mu       sync.Mutex
+	attempts []int
+}
+
+func (b *recordBackoff) NextBackoff(attempt int) time.Duration {
+	b.mu.Lock()
+	b.attempts = append(b.attempts, attempt)
+	b.mu.Unlock()
+	return time.Millisecond
+}
+
+func TestChannelPool_Backoff(t *testing.T) {
+	var calls int32
+	backoff := &recordBackoff{}
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 0,
+		MaxCap:     1,
+		Factory: func() (interface{}, error) {
+			if atomic.AddInt32(&calls, 1) <= 3 {
+				return nil, errors.New("backend unavailable")
+			}
+			return factory()
+		},
+		Close:          closer,
+		ConnectRetries: 3,
+		Backoff:        backoff,
+	})
+	defer p.Release()
+
+	wrapConn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	p.Put(wrapConn)
+
+	backoff.mu.Lock()
+	defer backoff.mu.Unlock()
+	if fmt.Sprint(backoff.attempts) != "[0 1 2]" {
+		t.Errorf("The backoff attempts were %v but should be [0 1 2]", backoff.attempts)
+	}
+}
+
+func TestChannelPool_DisableCreation(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 2,
+		MaxCap:     4,
+		Factory:    factory,
+		Close:      closer,
+	})
+	defer p.Release()
+
+	p.DisableCreation()
+	c1, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	c2, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	if _, err := p.Get(); err != ErrCreationDisabled {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrCreationDisabled, err)
+	}
+	if _, err := p.TryGet(); err != ErrCreationDisabled {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrCreationDisabled, err)
+	}
+
+	p.EnableCreation()
+	c3, err := p.Get()
+	if err != nil {
+		t.Errorf("Get error after EnableCreation: %s", err)
+	}
+	p.Put(c1)
+	p.Put(c2)
+	p.Put(c3)
+}
+
+func TestChannelPool_ReleaseResetsQueue(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:     0,
+		MaxCap:         1,
+		ConcurrentBase: 1,
+		Factory:        factory,
+		Close:          closer,
+	})
+	defer p.Release()
+	cp := p.(*channelPool)
+
+	c1, _ := p.Get()
+	p.Release()
+	if q := len(cp.getQueue()); q != 0 {
+		t.Errorf("The queue length was %d but should be 0", q)
+	}
+
+	// 新的 queue 不受 Release 之前取出的连接影响
+	c2, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.Put(c1)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Put of a conn from before Release blocked")
+	}
+	if a := p.Len(); a != 0 {
+		t.Errorf("The pool available was %d but should be 0", a)
+	}
+
+	p.Put(c2)
+	if a := p.Len(); a != 1 {
+		t.Errorf("The pool available was %d but should be 1", a)
+	}
+	if q := len(cp.getQueue()); q != 1 {
+		t.Errorf("The queue length was %d but should be 1", q)
+	}
+}
+
+func TestChannelPool_Warmup(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 0,
+		MaxCap:     5,
+		Factory:    factory,
+		Close:      closer,
+	})
+	defer p.Release()
+
+	if err := p.Warmup(3); err != nil {
+		t.Errorf("Warmup returned an error: %s", err)
+	}
+	if a := p.Len(); a != 3 {
+		t.Errorf("The pool available was %d but should be 3", a)
+	}
+
+	// 空闲队列已满时提前停止
+	if err := p.Warmup(10); err != nil {
+		t.Errorf("Warmup returned an error: %s", err)
+	}
+	if a := p.Len(); a != 5 {
+		t.Errorf("The pool available was %d but should be 5", a)
+	}
+	if q := len(p.(*channelPool).getQueue()); q != 5 {
+		t.Errorf("The queue length was %d but should be 5", q)
+	}
+
+	// 连接池已关闭时不再新建连接
+	p.ClosePool()
+	if err := p.Warmup(1); err != ErrPoolClosed {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrPoolClosed, err)
+	}
+}
+
+func TestChannelPool_DoublePut(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 0,
+		MaxCap:     2,
+		Factory:    factory,
+		Close:      closer,
+	})
+	defer p.Release()
+
+	wrapConn, _ := p.Get()
+	if err := p.Put(wrapConn); err != nil {
+		t.Errorf("Put returned an error: %s", err)
+	}
+	if err := p.Put(wrapConn); err != ErrConnClosed {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrConnClosed, err)
+	}
+
+	if n := p.Stats().DoublePut; n != 1 {
+		t.Errorf("DoublePut was %d but should be 1", n)
+	}
+	if a := p.Len(); a != 1 {
+		t.Errorf("The pool available was %d but should be 1", a)
+	}
+	if q := len(p.(*channelPool).getQueue()); q != 1 {
+		t.Errorf("The queue length was %d but should be 1", q)
+	}
+}
+
+func TestIdleConn_LastUsed(t *testing.T) {
+	now := time.Now().Add(-time.Minute)
+	wrapConn := NewIdleConn("conn", now, nil)
+
+	if lastUsed, err := wrapConn.LastUsed(); err != nil || !lastUsed.Equal(now) {
+		t.Errorf("LastUsed was %s, %v but should be %s", lastUsed, err, now)
+	}
+	if age, err := wrapConn.Age(); err != nil || age < time.Minute {
+		t.Errorf("Age was %s, %v but should be at least 1m", age, err)
+	}
+
+	wrapConn.Close()
+	if _, err := wrapConn.LastUsed(); err != ErrConnClosed {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrConnClosed, err)
+	}
+	if _, err := wrapConn.Age(); err != ErrConnClosed {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrConnClosed, err)
+	}
+}
+
+func TestChannelPool_WarmupAsync(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 0,
+		MaxCap:     5,
+		Factory: func() (interface{}, error) {
+			time.Sleep(10 * time.Millisecond)
+			return factory()
+		},
+		Close: closer,
+	})
+	defer p.Release()
+
+	p.WarmupAsync(3)
+	select {
+	case <-p.Ready():
+		t.Fatal("Ready fired before warmup finished")
+	default:
+	}
+
+	select {
+	case <-p.Ready():
+	case <-time.After(time.Second):
+		t.Fatal("Ready did not fire after warmup")
+	}
+	if a := p.Len(); a != 3 {
+		t.Errorf("The pool available was %d but should be 3", a)
+	}
+}
+
+func TestChannelPool_WarmupAsyncPoolFull(t *testing.T) {
+	logger := &testLogger{}
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 0,
+		MaxCap:     2,
+		Factory:    factory,
+		Close:      closer,
+		Logger:     logger,
+	})
+	defer p.Release()
+
+	// Release 之后仍可在后台补充
+	p.Release()
+	p.WarmupAsync(3)
+	select {
+	case <-p.Ready():
+	case <-time.After(time.Second):
+		t.Fatal("Ready did not fire after the pool was full")
+	}
+	if a := p.Len(); a != 2 {
+		t.Errorf("The pool available was %d but should be 2", a)
+	}
+	if n := logger.Len(); n != 1 {
+		t.Errorf("%d messages were logged but should be 1", n)
+	}
+}
+
+func TestChannelPool_Drain(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 3,
+		MaxCap:     3,
+		Factory:    factory,
+		Close:      closer,
+	})
+	defer p.Release()
+	cp := p.(*channelPool)
+
+	c1, _ := p.Get()
+	if err := p.Drain(); err != nil {
+		t.Errorf("Drain returned an error: %s", err)
+	}
+	if a := p.Len(); a != 0 {
+		t.Errorf("The pool available was %d but should be 0", a)
+	}
+	if q := len(cp.getQueue()); q != 1 {
+		t.Errorf("The queue length was %d but should be 1", q)
+	}
+
+	c2, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	p.Put(c1)
+	p.Put(c2)
+	if a := p.Len(); a != 2 {
+		t.Errorf("The pool available was %d but should be 2", a)
+	}
+
+	p.ClosePool()
+	if err := p.Drain(); err != ErrPoolClosed {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrPoolClosed, err)
+	}
+}
+
+func TestChannelPool_GetValidated(t *testing.T) {
+	var n int32
+	var closed int32
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 0,
+		MaxCap:     5,
+		Factory: func() (interface{}, error) {
+			return int(atomic.AddInt32(&n, 1)), nil
+		},
+		Close: func(interface{}) error {
+			atomic.AddInt32(&closed, 1)
+			return nil
+		},
+	})
+	defer p.Release()
+
+	p.Warmup(3)
+	even := func(conn interface{}) bool { return conn.(int)%2 == 0 }
+	for i := 0; i < 2; i++ {
+		wrapConn, err := p.GetValidated(context.Background(), even)
+		if err != nil {
+			t.Fatalf("GetValidated error: %s", err)
+		}
+		if conn, _ := wrapConn.Get(); !even(conn) {
+			t.Errorf("GetValidated returned %v which fails the validator", conn)
+		}
+	}
+
+	// 1、3 两个空闲连接未通过检查被关闭，之后新建了 4
+	if c := atomic.LoadInt32(&closed); c != 2 {
+		t.Errorf("Close was called %d times but should be 2", c)
+	}
+	if m := atomic.LoadInt32(&n); m != 4 {
+		t.Errorf("Factory was called %d times but should be 4", m)
+	}
+}
+
+func TestChannelPool_WaitForConn(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:     1,
+		MaxCap:         1,
+		ConcurrentBase: 1,
+		Factory:        factory,
+		Close:          closer,
+		PoolTimeout:    50 * time.Millisecond,
+		WaitForConn:    true,
+	})
+	defer p.Release()
+
+	c1, _ := p.Get()
+	got := make(chan error, 1)
+	go func() {
+		c2, err := p.Get()
+		if err == nil {
+			p.Put(c2)
+		}
+		got <- err
+	}()
+
+	// 超过 PoolTimeout 仍在等待
+	select {
+	case err := <-got:
+		t.Fatalf("Get returned before Put: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	p.Put(c1)
+	select {
+	case err := <-got:
+		if err != nil {
+			t.Errorf("Get error: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Get was not unblocked by Put")
+	}
+
+	// Release 时等待的 Get 返回 ErrPoolClosed
+	c1, _ = p.Get()
+	go func() {
+		_, err := p.Get()
+		got <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	p.Release()
+	select {
+	case err := <-got:
+		if err != ErrPoolClosed {
+			t.Errorf("Expected error \"%s\" but got \"%v\"", ErrPoolClosed, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Get was not unblocked by Release")
+	}
+	p.Put(c1)
+}
+
+func TestChannelPool_EstimatedMemory(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:   2,
+		MaxCap:       4,
+		Factory:      factory,
+		Close:        closer,
+		PerConnBytes: 1024,
+	})
+	defer p.Release()
+
+	if m := p.EstimatedMemory(); m != 2048 {
+		t.Errorf("EstimatedMemory was %d but should be 2048", m)
+	}
+
+	c1, _ := p.Get()
+	c2, _ := p.Get()
+	c3, _ := p.Get()
+	if m := p.EstimatedMemory(); m != 3072 {
+		t.Errorf("EstimatedMemory was %d but should be 3072", m)
+	}
+
+	p.Put(c1)
+	p.Put(c2)
+	p.Close(c3)
+	if m := p.EstimatedMemory(); m != 2048 {
+		t.Errorf("EstimatedMemory was %d but should be 2048", m)
+	}
+}
+
+func TestChannelPool_Handoff(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:     1,
+		MaxCap:         1,
+		ConcurrentBase: 1,
+		Factory:        factory,
+		Close:          closer,
+	})
+	defer p.Release()
+	cp := p.(*channelPool)
+
+	c1, _ := p.Get()
+	want, _ := c1.ID()
+
+	got := make(chan *IdleConn, 1)
+	go func() {
+		wrapConn, _ := p.Get()
+		got <- wrapConn
+	}()
+
+	// 等待 Get 进入等待队列
+	idle := cp.getIdle()
+	for i := 0; i < 100; i++ {
+		idle.mu.Lock()
+		n := len(idle.waiters)
+		idle.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	p.Put(c1)
+	select {
+	case wrapConn := <-got:
+		if id, _ := wrapConn.ID(); id != want {
+			t.Errorf("The waiter received conn %d but should be %d", id, want)
+		}
+		p.Put(wrapConn)
+	case <-time.After(time.Second):
+		t.Fatal("The waiter was not handed the returned conn")
+	}
+}
+
+func TestChannelPool_BackgroundPanic(t *testing.T) {
+	var calls int32
+	logger := &testLogger{}
+	p, _ := NewChannelPool(&Config{
+		InitialCap:         2,
+		MaxCap:             2,
+		Factory:            factory,
+		Close:              closer,
+		IdleTimeout:        30 * time.Millisecond,
+		IdleCheckFrequency: 10 * time.Millisecond,
+		Logger:             logger,
+		OnClose: func(conn interface{}, reason CloseReason) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				panic("on close")
+			}
+		},
+	})
+	defer p.Release()
+
+	deadline := time.Now().Add(time.Second)
+	for p.Len() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if a := p.Len(); a != 0 {
+		t.Errorf("The pool available was %d but should be 0", a)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("OnClose was called %d times but should be 2", n)
+	}
+	if logger.Len() == 0 {
+		t.Error("The reaper panic was not logged")
+	}
+}
+
+func TestChannelPool_HealthCheckPanic(t *testing.T) {
+	factory, closer, stats := NewMockFactory()
+	var pings int32
+	logger := &testLogger{}
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 2,
+		MaxCap:     2,
+		Factory:    factory,
+		Close:      closer,
+		Ping: func(conn interface{}) error {
+			if atomic.AddInt32(&pings, 1) == 1 {
+				panic("ping")
+			}
+			return stats.Ping(conn)
+		},
+		HealthCheckFrequency: 10 * time.Millisecond,
+		Logger:               logger,
+	})
+
+	deadline := time.Now().Add(time.Second)
+	for logger.Len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if logger.Len() == 0 {
+		t.Fatal("The health check panic was not logged")
+	}
+
+	// panic 时取出的连接被关闭，不占用 queue 位置
+	if n := p.InUse(); n != 0 {
+		t.Errorf("%d conns were in use but should be 0", n)
+	}
+	p.ClosePool()
+	if n := stats.Open(); n != 0 {
+		t.Errorf("%d conns were still open but should be 0", n)
+	}
+}
+
+func TestChannelPool_FactoryPanic(t *testing.T) {
+	var dials int32
+	panicOnce := func(n int32) func() (interface{}, error) {
+		return func() (interface{}, error) {
+			if atomic.AddInt32(&dials, 1) == n {
+				panic("factory")
+			}
+			return factory()
+		}
+	}
+
+	// 后台补充时 Factory panic 不占用 queue 位置
+	p, _ := NewChannelPool(&Config{
+		InitialCap:            0,
+		MaxCap:                2,
+		ConcurrentBase:        1,
+		Factory:               panicOnce(1),
+		Close:                 closer,
+		MinIdle:               1,
+		MinIdleCheckFrequency: 10 * time.Millisecond,
+		PoolTimeout:           100 * time.Millisecond,
+		Logger:                &testLogger{},
+	})
+	deadline := time.Now().Add(time.Second)
+	for p.Len() < 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	c1, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	c2, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	p.Put(c1)
+	p.Put(c2)
+	p.ClosePool()
+
+	// WarmupAsync panic 后只补充剩余的连接
+	atomic.StoreInt32(&dials, 0)
+	p, _ = NewChannelPool(&Config{
+		InitialCap: 0,
+		MaxCap:     5,
+		Factory:    panicOnce(2),
+		Close:      closer,
+		Logger:     &testLogger{},
+	})
+	defer p.Release()
+	p.WarmupAsync(3)
+	select {
+	case <-p.Ready():
+	case <-time.After(time.Second):
+		t.Fatal("Ready did not fire after warmup")
+	}
+	if a := p.Len(); a != 3 {
+		t.Errorf("The pool available was %d but should be 3", a)
+	}
+}
+
+func TestChannelPool_MaxActive(t *testing.T) {
+	if _, err := NewChannelPool(&Config{
+		InitialCap:     1,
+		MaxCap:         2,
+		Factory:        factory,
+		Close:          closer,
+		ConcurrentBase: -1,
+	}); err == nil {
+		t.Error("Expected an error for negative ConcurrentBase")
+	}
+
+	for _, base := range []int{1, 3} {
+		p, _ := NewChannelPool(&Config{
+			InitialCap:     0,
+			MaxCap:         2,
+			Factory:        factory,
+			Close:          closer,
+			ConcurrentBase: base,
+			PoolTimeout:    20 * time.Millisecond,
+		})
+		if m := p.MaxActive(); m != base*2 {
+			t.Errorf("MaxActive was %d but should be %d", m, base*2)
+		}
+
+		var conns []*IdleConn
+		for {
+			wrapConn, err := p.Get()
+			if err != nil {
+				if err != ErrPoolTimeout {
+					t.Errorf("Expected error \"%s\" but got \"%v\"", ErrPoolTimeout, err)
+				}
+				break
+			}
+			conns = append(conns, wrapConn)
+		}
+		if len(conns) != base*2 {
+			t.Errorf("%d conns were checked out but should be %d", len(conns), base*2)
+		}
+		p.Release()
+	}
+}
+
+func TestChannelPool_MaxCreateRate(t *testing.T) {
+	var created int32
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 0,
+		MaxCap:     10,
+		Factory: func() (interface{}, error) {
+			atomic.AddInt32(&created, 1)
+			return factory()
+		},
+		Close:         closer,
+		PoolTimeout:   2 * time.Second,
+		MaxCreateRate: 20,
+		CreateBurst:   2,
+	})
+	defer p.Release()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	conns := make(chan *IdleConn, 6)
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wrapConn, err := p.Get()
+			if err != nil {
+				t.Errorf("Get error: %s", err)
+				return
+			}
+			conns <- wrapConn
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	close(conns)
+	for wrapConn := range conns {
+		p.Put(wrapConn)
+	}
+
+	// 除去 burst 的 2 个，其余 4 个按每秒 20 个新建，至少需要 200ms
+	if n := atomic.LoadInt32(&created); n != 6 {
+		t.Errorf("Factory was called %d times but should be 6", n)
+	}
+	if elapsed < 180*time.Millisecond {
+		t.Errorf("6 conns were created in %s, faster than MaxCreateRate allows", elapsed)
+	}
+
+	// 令牌不足时 PoolTimeout 内等不到返回 ErrPoolTimeout
+	p2, _ := NewChannelPool(&Config{
+		InitialCap:    0,
+		MaxCap:        2,
+		Factory:       factory,
+		Close:         closer,
+		PoolTimeout:   50 * time.Millisecond,
+		MaxCreateRate: 1,
+	})
+	defer p2.Release()
+	c1, _ := p2.Get()
+	if _, err := p2.Get(); err != ErrPoolTimeout {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrPoolTimeout, err)
+	}
+	if q := len(p2.(*channelPool).getQueue()); q != 1 {
+		t.Errorf("The queue length was %d but should be 1", q)
+	}
+	p2.Put(c1)
+}
+
+func TestChannelPool_MaxConnUses(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:  1,
+		MaxCap:      1,
+		Factory:     factory,
+		Close:       closer,
+		MaxConnUses: 2,
+	})
+	defer p.Release()
+
+	var ids []uint64
+	for i := 1; i <= 3; i++ {
+		wrapConn, err := p.Get()
+		if err != nil {
+			t.Fatalf("Get error: %s", err)
+		}
+		id, _ := wrapConn.ID()
+		ids = append(ids, id)
+		if uses, _ := wrapConn.Uses(); uses != (i-1)%2+1 {
+			t.Errorf("Uses was %d but should be %d", uses, (i-1)%2+1)
+		}
+		p.Put(wrapConn)
+	}
+
+	if ids[0] != ids[1] {
+		t.Errorf("The second Get returned conn %d but should reuse %d", ids[1], ids[0])
+	}
+	if ids[2] == ids[1] {
+		t.Errorf("The third Get reused conn %d after MaxConnUses", ids[2])
+	}
+}
+
+func TestChannelPool_RetainOnPut(t *testing.T) {
+	var closed int32
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 0,
+		MaxCap:     2,
+		Factory:    factory,
+		Close: func(i interface{}) error {
+			atomic.AddInt32(&closed, 1)
+			return closer(i)
+		},
+		RetainOnPut: func(conn interface{}, age time.Duration, uses int, lastErr error) bool {
+			return uses < 2 && lastErr == nil
+		},
+	})
+	defer p.Release()
+
+	wrapConn, _ := p.Get()
+	p.Put(wrapConn)
+	if a := p.Len(); a != 1 {
+		t.Errorf("The pool available was %d but should be 1", a)
+	}
+
+	wrapConn, _ = p.Get()
+	p.Put(wrapConn)
+	if a := p.Len(); a != 0 {
+		t.Errorf("The pool available was %d but should be 0", a)
+	}
+	if n := atomic.LoadInt32(&closed); n != 1 {
+		t.Errorf("Close was called %d times but should be 1", n)
+	}
+}
+
+func TestChannelPool_SetIdleStore(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 0,
+		MaxCap:     3,
+		Factory:    factory,
+		Close:      closer,
+		PoolFIFO:   true,
+	})
+	defer p.Release()
+
+	var ids []uint64
+	var conns []*IdleConn
+	for i := 0; i < 3; i++ {
+		wrapConn, _ := p.Get()
+		id, _ := wrapConn.ID()
+		ids = append(ids, id)
+		conns = append(conns, wrapConn)
+	}
+	for _, wrapConn := range conns {
+		p.Put(wrapConn)
+	}
+
+	first, _ := p.Get()
+	if id, _ := first.ID(); id != ids[0] {
+		t.Errorf("FIFO Get returned conn %d but should be %d", id, ids[0])
+	}
+	p.SetIdleStore(LIFOStore)
+	if a := p.Len(); a != 2 {
+		t.Errorf("The pool available was %d but should be 2", a)
+	}
+	second, _ := p.Get()
+	if id, _ := second.ID(); id != ids[2] {
+		t.Errorf("LIFO Get returned conn %d but should be %d", id, ids[2])
+	}
+	p.Put(first)
+	p.Put(second)
+}
+
+func TestChannelPool_HealthCheck(t *testing.T) {
+	var broken int32
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 3,
+		MaxCap:     3,
+		Factory:    factory,
+		Close:      closer,
+		Ping: func(interface{}) error {
+			if atomic.LoadInt32(&broken) == 1 {
+				return errors.New("conn is broken")
+			}
+			return nil
+		},
+		HealthCheckFrequency: 10 * time.Millisecond,
+	})
+	defer p.Release()
+
+	time.Sleep(50 * time.Millisecond)
+	if a := p.Len(); a != 3 {
+		t.Errorf("The pool available was %d but should be 3", a)
+	}
+
+	atomic.StoreInt32(&broken, 1)
+	deadline := time.Now().Add(time.Second)
+	for p.Len() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if a := p.Len(); a != 0 {
+		t.Errorf("The pool available was %d but should be 0", a)
+	}
+	if q := len(p.(*channelPool).getQueue()); q != 0 {
+		t.Errorf("The queue length was %d but should be 0", q)
+	}
+}
+
+func TestChannelPool_FinalStats(t *testing.T) {
+	var snapshots []Stats
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     2,
+		Factory:    factory,
+		Close:      closer,
+		OnStats:    func(s Stats) { snapshots = append(snapshots, s) },
+	})
+
+	c1, _ := p.Get()
+	c2, _ := p.Get()
+	p.Put(c1)
+	p.Put(c2)
+
+	p.ClosePool()
+	p.ClosePool()
+	if len(snapshots) != 1 {
+		t.Fatalf("OnStats was called %d times but should be 1", len(snapshots))
+	}
+	if s := snapshots[0]; s.Hits != 1 || s.Misses != 1 || s.IdleConns != 2 {
+		t.Errorf("The final stats were %+v but should have 1 hit, 1 miss and 2 idle conns", s)
+	}
+}
+
+func TestChannelPool_PutReleaseRace(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 2,
+		MaxCap:     4,
+		Factory:    func() (interface{}, error) { return new(int), nil },
+		Close:      func(interface{}) error { return nil },
+	})
+	defer p.Release()
+	cp := p.(*channelPool)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				wrapConn, err := p.Get()
+				if err != nil {
+					continue
+				}
+				p.Put(wrapConn)
+			}
+		}()
+	}
+
+	var releases sync.WaitGroup
+	releases.Add(1)
+	go func() {
+		defer releases.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				p.Release()
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(stop)
+	releases.Wait()
+
+	if q, a := len(cp.getQueue()), p.Len(); q != a {
+		t.Errorf("The queue length was %d but should equal the idle count %d", q, a)
+	}
+}
+
+func TestIdleConn_Reset(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     1,
+		Factory:    factory,
+		Close:      closer,
+	})
+	defer p.Release()
+
+	wrapConn, _ := p.Get()
+	before, _ := wrapConn.Get()
+	if err := wrapConn.Reset(); err != nil {
+		t.Fatalf("Reset error: %s", err)
+	}
+	after, err := wrapConn.Get()
+	if err != nil {
+		t.Fatalf("Get after Reset error: %s", err)
+	}
+	if before == after {
+		t.Error("Reset did not replace the underlying conn")
+	}
+	if q := len(p.(*channelPool).getQueue()); q != 1 {
+		t.Errorf("The queue length was %d but should be 1", q)
+	}
+
+	if err := p.Put(wrapConn); err != nil {
+		t.Errorf("Put after Reset returned an error: %s", err)
+	}
+	if a := p.Len(); a != 1 {
+		t.Errorf("The pool available was %d but should be 1", a)
+	}
+	if err := wrapConn.Reset(); err != ErrConnClosed {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrConnClosed, err)
+	}
+}
+
+func TestIdleConn_ResetGates(t *testing.T) {
+	dialing := make(chan struct{})
+	proceed := make(chan struct{})
+	var dials int32
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     1,
+		Factory: func() (interface{}, error) {
+			if atomic.AddInt32(&dials, 1) > 1 {
+				close(dialing)
+				<-proceed
+			}
+			return factory()
+		},
+		Close: closer,
+	})
+	defer p.Release()
+
+	wrapConn, _ := p.Get()
+	p.DisableCreation()
+	if err := wrapConn.Reset(); err != ErrCreationDisabled {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrCreationDisabled, err)
+	}
+	p.EnableCreation()
+
+	// 新建连接期间不阻塞 IdleConn 的其他方法
+	done := make(chan error, 1)
+	go func() { done <- wrapConn.Reset() }()
+	<-dialing
+	if _, err := wrapConn.Get(); err != nil {
+		t.Errorf("Get during Reset returned an error: %s", err)
+	}
+	close(proceed)
+	if err := <-done; err != nil {
+		t.Errorf("Reset error: %s", err)
+	}
+
+	p.ClosePool()
+	if err := wrapConn.Reset(); err != ErrPoolClosed {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrPoolClosed, err)
+	}
+	p.Put(wrapConn)
+}
+
+func TestChannelPool_FactoryContext(t *testing.T) {
+	p, err := NewChannelPool(&Config{
+		InitialCap: 0,
+		MaxCap:     1,
+		FactoryContext: func(ctx context.Context) (interface{}, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+		Close:       closer,
+		PoolTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewChannelPool error: %s", err)
+	}
+	defer p.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = p.GetContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", context.DeadlineExceeded, err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("GetContext returned after %s but should return when ctx is done", d)
+	}
+	if q := len(p.(*channelPool).getQueue()); q != 0 {
+		t.Errorf("The queue length was %d but should be 0", q)
+	}
+}
+
+func TestChannelPool_AllowPartialFill(t *testing.T) {
+	errFactory := errors.New("factory failed")
+	var calls int32
+	failSecond := func() (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 2 {
+			return nil, errFactory
+		}
+		return factory()
+	}
+
+	if _, err := NewChannelPool(&Config{
+		InitialCap: 3,
+		MaxCap:     3,
+		Factory:    failSecond,
+		Close:      closer,
+	}); err == nil || errors.Is(err, ErrPartialFill) {
+		t.Errorf("Expected a fill error without AllowPartialFill but got \"%v\"", err)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	logger := &testLogger{}
+	p, err := NewChannelPool(&Config{
+		InitialCap:       3,
+		MaxCap:           3,
+		Factory:          failSecond,
+		Close:            closer,
+		Logger:           logger,
+		AllowPartialFill: true,
+	})
+	if !errors.Is(err, ErrPartialFill) {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrPartialFill, err)
+	}
+	if p == nil {
+		t.Fatal("NewChannelPool should return the pool on a partial fill")
+	}
+	defer p.Release()
+
+	if a := p.Len(); a != 2 {
+		t.Errorf("The pool available was %d but should be 2", a)
+	}
+	if logger.Len() != 1 {
+		t.Errorf("%d messages were logged but should be 1", logger.Len())
+	}
+}
+
+func TestChannelPool_PingTimeout(t *testing.T) {
+	var slow atomic.Value
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     1,
+		Factory:    factory,
+		Close:      closer,
+		Ping: func(conn interface{}) error {
+			if conn == slow.Load() {
+				time.Sleep(200 * time.Millisecond)
+			}
+			return nil
+		},
+		PingTimeout: 20 * time.Millisecond,
+	})
+	defer p.Release()
+
+	wrapConn, _ := p.Get()
+	conn, _ := wrapConn.Get()
+	slow.Store(conn)
+	p.Put(wrapConn)
+
+	start := time.Now()
+	wrapConn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	if d := time.Since(start); d > 150*time.Millisecond {
+		t.Errorf("Get took %s but the ping should time out after 20ms", d)
+	}
+	if newConn, _ := wrapConn.Get(); newConn == conn {
+		t.Error("The conn with a timed out ping should be regenerated")
+	}
+	if err := p.Ping(wrapConn); err != nil {
+		t.Errorf("Ping of the regenerated conn returned an error: %s", err)
+	}
+	p.Put(wrapConn)
+}
+
+func TestChannelPool_PingTimeoutPanic(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     1,
+		Factory:    factory,
+		Close:      closer,
+		Ping: func(interface{}) error {
+			panic("ping")
+		},
+		PingTimeout: 20 * time.Millisecond,
+	})
+	defer p.Release()
+
+	wrapConn, err := p.TryGet()
+	if err != nil {
+		t.Fatalf("TryGet error: %s", err)
+	}
+	err = p.Ping(wrapConn)
+	var pingErr *PingError
+	if !errors.As(err, &pingErr) || !errors.Is(err, ErrPingPanicked) {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrPingPanicked, err)
+	}
+	p.Close(wrapConn)
+}
+
+func TestChannelPool_BatchGet(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:     3,
+		MaxCap:         3,
+		ConcurrentBase: 1,
+		Factory:        factory,
+		Close:          closer,
+		PoolTimeout:    20 * time.Millisecond,
+	})
+	defer p.Release()
+
+	conns, err := p.BatchGet(3)
+	if err != nil {
+		t.Fatalf("BatchGet error: %s", err)
+	}
+	if len(conns) != 3 {
+		t.Errorf("BatchGet returned %d conns but should return 3", len(conns))
+	}
+	for _, wrapConn := range conns {
+		p.Put(wrapConn)
+	}
+
+	conns, err = p.BatchGet(4)
+	if err != ErrPoolTimeout {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrPoolTimeout, err)
+	}
+	if conns != nil {
+		t.Errorf("BatchGet returned %d conns on error", len(conns))
+	}
+	if a := p.Len(); a != 3 {
+		t.Errorf("The pool available was %d but should be 3", a)
+	}
+}
+
+func TestChannelPool_FactoryMeta(t *testing.T) {
+	var shard int32
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     2,
+		FactoryMeta: func() (interface{}, map[string]interface{}, error) {
+			conn, err := factory()
+			return conn, map[string]interface{}{"shard": atomic.AddInt32(&shard, 1)}, err
+		},
+		Close: closer,
+	})
+	defer p.Release()
+
+	wrapConn, _ := p.Get()
+	p.Put(wrapConn)
+	wrapConn, _ = p.Get()
+	meta, err := wrapConn.Meta()
+	if err != nil {
+		t.Fatalf("Meta error: %s", err)
+	}
+	if meta["shard"] != int32(1) {
+		t.Errorf("The shard was %v but should be 1", meta["shard"])
+	}
+	p.Put(wrapConn)
+	if _, err := wrapConn.Meta(); err != ErrConnClosed {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrConnClosed, err)
+	}
+}
+
+func TestChannelPool_PutKeepsAge(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     1,
+		Factory:    factory,
+		Close:      closer,
+	})
+	defer p.Release()
+
+	var lastAge time.Duration
+	for i := 0; i < 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+		wrapConn, _ := p.Get()
+		age, _ := wrapConn.Age()
+		if age <= lastAge {
+			t.Errorf("Age was %s but should be greater than %s", age, lastAge)
+		}
+		lastAge = age
+		p.Put(wrapConn)
+
+		wrapConn, _ = p.Get()
+		if lastUsed, _ := wrapConn.LastUsed(); time.Since(lastUsed) >= 10*time.Millisecond {
+			t.Errorf("LastUsed was %s ago but should be reset by Put", time.Since(lastUsed))
+		}
+		p.Put(wrapConn)
+	}
+}
+
+func TestChannelPool_OnGetOnPut(t *testing.T) {
+	errHook := errors.New("hook failed")
+	var failGet, failPut atomic.Value
+	var closed []CloseReason
+	var mu sync.Mutex
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     2,
+		Factory:    factory,
+		Close:      closer,
+		OnGet: func(conn interface{}) error {
+			if conn == failGet.Load() {
+				return errHook
+			}
+			return nil
+		},
+		OnPut: func(conn interface{}) error {
+			if conn == failPut.Load() {
+				return errHook
+			}
+			return nil
+		},
+		OnClose: func(conn interface{}, reason CloseReason) {
+			mu.Lock()
+			closed = append(closed, reason)
+			mu.Unlock()
+		},
+	})
+	defer p.Release()
+
+	wrapConn, _ := p.Get()
+	conn, _ := wrapConn.Get()
+	p.Put(wrapConn)
+
+	failGet.Store(conn)
+	wrapConn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	if newConn, _ := wrapConn.Get(); newConn == conn {
+		t.Error("The conn rejected by OnGet should be regenerated")
+	}
+
+	newConn, _ := wrapConn.Get()
+	failPut.Store(newConn)
+	p.Put(wrapConn)
+	if a := p.Len(); a != 0 {
+		t.Errorf("The pool available was %d but should be 0", a)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(closed) != 2 || closed[0] != ReasonHookFailed || closed[1] != ReasonHookFailed {
+		t.Errorf("The close reasons were %v but should be [hook failed hook failed]", closed)
+	}
+}
+
+func TestChannelPool_Fallbacks(t *testing.T) {
+	errPrimary := errors.New("primary down")
+	p, err := NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     2,
+		Factory:    func() (interface{}, error) { return nil, errPrimary },
+		Fallbacks: []func() (interface{}, error){
+			func() (interface{}, error) { return nil, errPrimary },
+			factory,
+		},
+		Close: closer,
+		Ping:  NetConnPing(),
+	})
+	if err != nil {
+		t.Fatalf("NewChannelPool error: %s", err)
+	}
+	defer p.Release()
+
+	wrapConn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	if err := p.Ping(wrapConn); err != nil {
+		t.Errorf("Ping returned an error: %s", err)
+	}
+	if meta, _ := wrapConn.Meta(); meta["fallback"] != 1 {
+		t.Errorf("The fallback was %v but should be 1", meta["fallback"])
+	}
+	p.Put(wrapConn)
+
+	_, err = NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     1,
+		Factory:    func() (interface{}, error) { return nil, errPrimary },
+		Fallbacks: []func() (interface{}, error){
+			func() (interface{}, error) { return nil, errPrimary },
+		},
+		Close: closer,
+	})
+	if !errors.Is(err, ErrConnGenerateFailed) {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrConnGenerateFailed, err)
+	}
+}
+
+func TestChannelPool_Shutdown(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 2,
+		MaxCap:     2,
+		Factory:    factory,
+		Close:      closer,
+	})
+
+	wrapConn, _ := p.Get()
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Shutdown(context.Background())
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned %v before the conn was put back", err)
+	default:
+	}
+	if _, err := p.Get(); err != ErrPoolClosed {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrPoolClosed, err)
+	}
+
+	p.Put(wrapConn)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Shutdown returned an error: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown did not return after the conn was put back")
+	}
+	if s := p.Stats(); s.TotalConns != 0 {
+		t.Errorf("The pool had %d conns but should have 0", s.TotalConns)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	p, _ = NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     1,
+		Factory:    factory,
+		Close:      closer,
+	})
+	p.Get()
+	if err := p.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", context.DeadlineExceeded, err)
+	}
+	if _, err := p.Get(); err != ErrPoolClosed {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrPoolClosed, err)
+	}
+}
+
+func TestChannelPool_PutFull(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:     2,
+		MaxCap:         2,
+		ConcurrentBase: 2,
+		Factory:        factory,
+		Close:          closer,
+	})
+	defer p.Release()
+
+	conns, err := p.BatchGet(3)
+	if err != nil {
+		t.Fatalf("BatchGet error: %s", err)
+	}
+	for _, wrapConn := range conns {
+		done := make(chan error, 1)
+		go func(wrapConn *IdleConn) {
+			done <- p.Put(wrapConn)
+		}(wrapConn)
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Put returned an error: %s", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Put blocked on a full pool")
+		}
+	}
+
+	if a := p.Len(); a != 2 {
+		t.Errorf("The pool available was %d but should be 2", a)
+	}
+	if q := len(p.(*channelPool).getQueue()); q != 2 {
+		t.Errorf("The queue length was %d but should be 2", q)
+	}
+}
+
+func TestChannelPool_GetRaw(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 2,
+		MaxCap:     2,
+		Factory:    factory,
+		Close:      closer,
+	})
+	defer p.Release()
+
+	func() {
+		conn, release, err := p.GetRaw()
+		if err != nil {
+			t.Fatalf("GetRaw error: %s", err)
+		}
+		defer release()
+
+		if _, ok := conn.(net.Conn); !ok {
+			t.Errorf("GetRaw returned %T but should return net.Conn", conn)
+		}
+		if a := p.Len(); a != 1 {
+			t.Errorf("The pool available was %d but should be 1", a)
+		}
+	}()
+
+	if a := p.Len(); a != 2 {
+		t.Errorf("The pool available was %d but should be 2", a)
+	}
+}
+
+func TestChannelPool_DetectReuse(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:  1,
+		MaxCap:      2,
+		Factory:     factory,
+		Close:       closer,
+		DetectReuse: true,
+	})
+	defer p.Release()
+
+	wrapConn, _ := p.Get()
+	if err := p.Put(wrapConn); err != nil {
+		t.Errorf("Put returned an error: %s", err)
+	}
+	if err := p.Put(wrapConn); err != ErrConnClosed {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrConnClosed, err)
+	}
+	if a := p.Len(); a != 1 {
+		t.Errorf("The pool available was %d but should be 1", a)
+	}
+
+	// 伪造一个持有同一底层连接的旧 IdleConn
+	wrapConn, _ = p.Get()
+	conn, _ := wrapConn.Get()
+	stale := NewIdleConn(conn, time.Now(), p)
+	stale.id = wrapConn.id
+	if err := p.Put(stale); err != ErrConnReused {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrConnReused, err)
+	}
+	if err := p.Put(wrapConn); err != nil {
+		t.Errorf("Put returned an error: %s", err)
+	}
+	if n := len(p.(*channelPool).checkouts); n != 0 {
+		t.Errorf("%d conns were still checked out but should be 0", n)
+	}
+}
+
+func TestChannelPool_ForEach(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 2,
+		MaxCap:     3,
+		Factory:    factory,
+		Close:      closer,
+	})
+	defer p.Release()
+
+	c1, _ := p.Get()
+	c2, _ := p.Get()
+	c3, _ := p.Get()
+	p.Put(c1)
+	p.Put(c2)
+	threshold := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	p.Put(c3)
+
+	// 关闭 threshold 之前放回的连接
+	closed := p.ForEach(func(conn interface{}, lastUsed time.Time) bool {
+		return lastUsed.After(threshold)
+	})
+	if closed != 2 {
+		t.Errorf("ForEach closed %d conns but should close 2", closed)
+	}
+	if a := p.Len(); a != 1 {
+		t.Errorf("The pool available was %d but should be 1", a)
+	}
+	if q := len(p.(*channelPool).getQueue()); q != 1 {
+		t.Errorf("The queue length was %d but should be 1", q)
+	}
+}
+
+func TestChannelPool_ReapKeepsOtherIdle(t *testing.T) {
+	factory, closer, stats := NewMockFactory()
+	closing := make(chan struct{})
+	var slow int32
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 0,
+		MaxCap:     2,
+		Factory:    factory,
+		Close: func(conn interface{}) error {
+			if atomic.CompareAndSwapInt32(&slow, 1, 0) {
+				close(closing)
+				time.Sleep(200 * time.Millisecond)
+			}
+			return closer(conn)
+		},
+		IdleTimeout:        50 * time.Millisecond,
+		IdleCheckFrequency: -1,
+	})
+	defer p.Release()
+
+	expired, _ := p.Get()
+	fresh, _ := p.Get()
+	p.Put(expired)
+	time.Sleep(60 * time.Millisecond)
+	p.Put(fresh)
+
+	atomic.StoreInt32(&slow, 1)
+	reaped := make(chan int, 1)
+	go func() { reaped <- p.ReapNow() }()
+	<-closing
+
+	// 关闭超时连接期间 Get 复用未超时的空闲连接
+	wrapConn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	if wrapConn.Fresh() {
+		t.Error("Get created a new conn while the reaper was closing an expired one")
+	}
+	if n := stats.Created(); n != 2 {
+		t.Errorf("%d conns were created but should be 2", n)
+	}
+	p.Put(wrapConn)
+	if n := <-reaped; n != 1 {
+		t.Errorf("ReapNow closed %d conns but should close 1", n)
+	}
+
+	// ForEach 的回调执行期间其余的空闲连接同样可用
+	wrapConn, _ = p.Get()
+	p.Put(wrapConn)
+	other, _ := p.Get()
+	p.Put(other)
+	var got *IdleConn
+	p.ForEach(func(conn interface{}, lastUsed time.Time) bool {
+		if got == nil {
+			got, _ = p.TryGet()
+		}
+		return true
+	})
+	if got == nil {
+		t.Error("TryGet found no idle conn during ForEach")
+	} else {
+		p.Put(got)
+	}
+}
+
+func TestChannelPool_IdleTimeoutJitter(t *testing.T) {
+	var mu sync.Mutex
+	var evicted []time.Time
+	p, _ := NewChannelPool(&Config{
+		InitialCap:         10,
+		MaxCap:             10,
+		Factory:            factory,
+		Close:              closer,
+		IdleTimeout:        20 * time.Millisecond,
+		IdleTimeoutJitter:  200 * time.Millisecond,
+		IdleCheckFrequency: -1,
+		OnClose: func(conn interface{}, reason CloseReason) {
+			mu.Lock()
+			evicted = append(evicted, time.Now())
+			mu.Unlock()
+		},
+	})
+	defer p.Release()
+
+	p.(*channelPool).forEachIdle(func(wrapConn *IdleConn) bool {
+		if d := wrapConn.idleTimeout; d < 20*time.Millisecond || d >= 220*time.Millisecond {
+			t.Errorf("The idle timeout was %s but should be in [20ms, 220ms)", d)
+		}
+		return true
+	})
+
+	deadline := time.Now().Add(time.Second)
+	for p.Len() > 0 && time.Now().Before(deadline) {
+		p.ReapNow()
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(evicted) != 10 {
+		t.Fatalf("%d conns were evicted but should be 10", len(evicted))
+	}
+	first, last := evicted[0], evicted[len(evicted)-1]
+	if spread := last.Sub(first); spread < 20*time.Millisecond {
+		t.Errorf("The conns were evicted within %s but should be spread out", spread)
+	}
+}
+
+func TestIdleConn_Fresh(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     2,
+		Factory:    factory,
+		Close:      closer,
+	})
+	defer p.Release()
+
+	c1, _ := p.Get()
+	if c1.Fresh() {
+		t.Error("The idle conn should not be fresh")
+	}
+	c2, _ := p.Get()
+	if !c2.Fresh() {
+		t.Error("The created conn should be fresh")
+	}
+	p.Put(c2)
+	c2, _ = p.Get()
+	if c2.Fresh() {
+		t.Error("The conn put back should not be fresh")
+	}
+	p.Put(c1)
+	p.Put(c2)
+}
+
+func TestChannelPool_MaxWaiters(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:     1,
+		MaxCap:         1,
+		ConcurrentBase: 1,
+		Factory:        factory,
+		Close:          closer,
+		PoolTimeout:    time.Second,
+		MaxWaiters:     2,
+	})
+	defer p.Release()
+
+	wrapConn, _ := p.Get()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if c, err := p.Get(); err == nil {
+				p.Put(c)
+			}
+		}()
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&p.(*channelPool).waiting) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	start := time.Now()
+	if _, err := p.Get(); err != ErrTooManyWaiters {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrTooManyWaiters, err)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("Get took %s but should fail fast", d)
+	}
+
+	p.Put(wrapConn)
+	wg.Wait()
+	if w := atomic.LoadInt32(&p.(*channelPool).waiting); w != 0 {
+		t.Errorf("%d Gets were still waiting but should be 0", w)
+	}
+}
+
+func TestChannelPool_PutDropsReferences(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     1,
+		Factory:    factory,
+		Close:      closer,
+	})
+	defer p.Release()
+
+	wrapConn, _ := p.Get()
+	p.Put(wrapConn)
+	// 放回后调用方持有的 IdleConn 不再引用底层连接和连接池
+	if wrapConn.conn != nil || wrapConn.pool != nil {
+		t.Errorf("The put conn still references conn %v and pool %v", wrapConn.conn, wrapConn.pool)
+	}
+
+	reused, _ := p.Get()
+	if reused == wrapConn {
+		t.Error("Get returned the IdleConn that was put back")
+	}
+	if err := p.Put(wrapConn); err != ErrConnClosed {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrConnClosed, err)
+	}
+	if _, err := reused.Get(); err != nil {
+		t.Errorf("Put of the stale IdleConn affected the reused conn: %s", err)
+	}
+	p.Put(reused)
+}
+
+func TestChannelPool_InUse(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 3,
+		MaxCap:     3,
+		Factory:    factory,
+		Close:      closer,
+	})
+
+	c1, _ := p.Get()
+	c2, _ := p.Get()
+	if n := p.InUse(); n != 2 {
+		t.Errorf("InUse was %d but should be 2", n)
+	}
+	if n := p.Idle(); n != 1 {
+		t.Errorf("Idle was %d but should be 1", n)
+	}
+
+	p.Put(c1)
+	p.Put(c2)
+	if n := p.InUse(); n != 0 {
+		t.Errorf("InUse was %d but should be 0", n)
+	}
+
+	p.ClosePool()
+	if n, m := p.InUse(), p.Idle(); n != 0 || m != 0 {
+		t.Errorf("InUse and Idle were %d and %d on a closed pool but should be 0", n, m)
+	}
+}
+
+func TestChannelPool_GetTimeout(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:     1,
+		MaxCap:         1,
+		ConcurrentBase: 1,
+		Factory:        factory,
+		Close:          closer,
+		PoolTimeout:    5 * time.Second,
+	})
+	defer p.Release()
+
+	wrapConn, _ := p.Get()
+	start := time.Now()
+	if _, err := p.GetTimeout(20 * time.Millisecond); err != ErrPoolTimeout {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrPoolTimeout, err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("GetTimeout took %s but should time out after 20ms", d)
+	}
+	if _, err := p.GetTimeout(0); err != ErrPoolTimeout {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrPoolTimeout, err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		p.Put(wrapConn)
+	}()
+	wrapConn, err := p.GetTimeout(time.Second)
+	if err != nil {
+		t.Fatalf("GetTimeout error: %s", err)
+	}
+	p.Put(wrapConn)
+}
+
+func TestChannelPool_RejectedConnsNoLeak(t *testing.T) {
+	factory, closer, stats := NewMockFactory()
+	var n int64
+	p, _ := NewChannelPool(&Config{
+		InitialCap:  2,
+		MaxCap:      4,
+		Factory:     factory,
+		Close:       closer,
+		Ping:        stats.Ping,
+		PingOnPut:   true,
+		PoolTimeout: time.Second,
+		OnGet: func(conn interface{}) error {
+			if atomic.AddInt64(&n, 1)%3 == 0 {
+				return errors.New("rejected")
+			}
+			return nil
+		},
+	})
+	defer p.Release()
+
+	for i := 0; i < 3000; i++ {
+		wrapConn, err := p.GetValidated(context.Background(), func(conn interface{}) bool {
+			return conn.(*MockConn).ID%2 == 0
+		})
+		if err != nil {
+			continue
+		}
+		switch i % 3 {
+		case 0:
+			p.Close(wrapConn)
+		case 1:
+			stats.SetPingError(errors.New("ping failed"))
+			p.Put(wrapConn)
+			stats.SetPingError(nil)
+		default:
+			p.Put(wrapConn)
+		}
+	}
+
+	if q, a := len(p.(*channelPool).getQueue()), p.Len(); q != a {
+		t.Errorf("The queue length was %d but should equal the %d idle conns", q, a)
+	}
+	p.Drain()
+	if q := len(p.(*channelPool).getQueue()); q != 0 {
+		t.Errorf("The queue length was %d but should be 0", q)
+	}
+	if open := stats.Open(); open != 0 {
+		t.Errorf("%d conns were still open but should be 0", open)
+	}
+}
+
+func TestChannelPool_HealthCheckKeepsIdleTime(t *testing.T) {
+	var pings int32
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 0,
+		MaxCap:     3,
+		Factory:    factory,
+		Close:      closer,
+		Ping: func(interface{}) error {
+			atomic.AddInt32(&pings, 1)
+			return nil
+		},
+		IdleTimeout:          100 * time.Millisecond,
+		IdleCheckFrequency:   10 * time.Millisecond,
+		HealthCheckFrequency: 5 * time.Millisecond,
+	})
+	defer p.Release()
+
+	conns, _ := p.BatchGet(3)
+	for _, wrapConn := range conns {
+		p.Put(wrapConn)
+		time.Sleep(5 * time.Millisecond)
+	}
+	putAt := time.Now()
+
+	// 后台 Ping 之后空闲连接仍按放回的先后顺序排列
+	time.Sleep(30 * time.Millisecond)
+	if atomic.LoadInt32(&pings) == 0 {
+		t.Fatal("The health checker did not ping the idle conns")
+	}
+	snapshot := p.(*channelPool).getIdle().snapshot()
+	for i := 1; i < len(snapshot); i++ {
+		if snapshot[i].t.Before(snapshot[i-1].t) {
+			t.Errorf("The idle conns were reordered by the health checker")
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for p.Len() != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if a := p.Len(); a != 0 {
+		t.Errorf("The pool available was %d but should be 0", a)
+	}
+	if d := time.Since(putAt); d > 500*time.Millisecond {
+		t.Errorf("The idle conns were evicted after %s but IdleTimeout is 100ms", d)
+	}
+}
+
+func TestIdleConn_GetPool(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 2,
+		MaxCap:     2,
+		Factory:    factory,
+		Close:      closer,
+	})
+	defer p.Release()
+
+	wrapConn, _ := p.Get()
+	owner, err := wrapConn.GetPool()
+	if err != nil {
+		t.Fatalf("GetPool error: %s", err)
+	}
+	if owner != p {
+		t.Error("GetPool should return the pool the conn was taken from")
+	}
+	if a := owner.Len(); a != 1 {
+		t.Errorf("The pool available was %d but should be 1", a)
+	}
+	if s := owner.Stats(); s.IdleConns != 1 || s.TotalConns != 2 {
+		t.Errorf("Stats reported %d idle of %d conns but should be 1 of 2", s.IdleConns, s.TotalConns)
+	}
+	if n := owner.InUse(); n != 1 {
+		t.Errorf("InUse was %d but should be 1", n)
+	}
+
+	owner.Put(wrapConn)
+	if _, err := wrapConn.GetPool(); err != ErrConnClosed {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrConnClosed, err)
+	}
+}
+
+func TestChannelPool_FairWaiters(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap:     1,
+		MaxCap:         1,
+		ConcurrentBase: 1,
+		Factory:        factory,
+		Close:          closer,
+		PoolTimeout:    5 * time.Second,
+	})
+	defer p.Release()
+	idle := p.(*channelPool).getIdle()
+
+	const n = 8
+	var mu sync.Mutex
+	var served []int
+	var wg sync.WaitGroup
+	wrapConn, _ := p.Get()
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c, err := p.Get()
+			if err != nil {
+				t.Errorf("Get error: %s", err)
+				return
+			}
+			mu.Lock()
+			served = append(served, i)
+			mu.Unlock()
+			// 交替放回和关闭，放回的连接和释放的 queue 位置都应交给最先等待的 Get
+			if i%2 == 0 {
+				p.Put(c)
+			} else {
+				p.Close(c)
+			}
+		}(i)
+
+		// 等待第 i 个 Get 进入等待队列后再启动下一个
+		for j := 0; j < 1000; j++ {
+			idle.mu.Lock()
+			waiting := len(idle.waiters)
+			idle.mu.Unlock()
+			if waiting == i+1 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		// 进入等待队列后还需阻塞在 queue 上
+		time.Sleep(time.Millisecond)
+	}
+
+	p.Put(wrapConn)
+	wg.Wait()
+	for i, got := range served {
+		if got != i {
+			t.Fatalf("The waiters were served in order %v but should be served in arrival order", served)
+		}
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	valid := func() *Config {
+		return &Config{InitialCap: 1, MaxCap: 2, Factory: factory, Close: closer}
+	}
+	if err := valid().Validate(); err != nil {
+		t.Errorf("Validate of a valid config returned an error: %s", err)
+	}
+
+	for _, tc := range []struct {
+		modify func(*Config)
+		want   error
+	}{
+		{func(c *Config) { c.InitialCap = 3 }, ErrInvalidCapacity},
+		{func(c *Config) { c.MaxCap = 0 }, ErrInvalidCapacity},
+		{func(c *Config) { c.ConcurrentBase = -1 }, ErrInvalidConcurrentBase},
+		{func(c *Config) { c.Factory = nil }, ErrNilFactory},
+		{func(c *Config) { c.Close = nil }, ErrNilClose},
+		{func(c *Config) { c.LowWatermark = 1; c.HighWatermark = 3 }, ErrInvalidWatermark},
+		{func(c *Config) { c.MinIdle = 3 }, ErrMinIdleExceedsMax},
+		{func(c *Config) { c.WarmupTarget = 3 }, ErrInvalidWarmupTarget},
+		{func(c *Config) { c.ConnectRetries = -1 }, ErrInvalidConnectRetry},
+		{func(c *Config) { c.MaxConnUses = -1 }, ErrInvalidMaxConnUses},
+		{func(c *Config) { c.MaxWaiters = -1 }, ErrInvalidMaxWaiters},
+		{func(c *Config) { c.ConnLeakThreshold = -time.Second }, ErrInvalidConnLeakThreshold},
+		{func(c *Config) { c.MaxCreateRate = -1 }, ErrInvalidCreateRate},
+		{func(c *Config) { c.ExpiryGrace = -1 }, ErrInvalidExpiryGrace},
+		{func(c *Config) { c.IdleTimeout = time.Minute; c.ExpiryGrace = 2 * time.Minute }, ErrInvalidExpiryGrace},
+		{func(c *Config) { c.KeepAliveFunc = func(interface{}) error { return nil } }, ErrInvalidKeepAlive},
+		{func(c *Config) { c.AdaptiveTimeout = true }, ErrInvalidAdaptiveTimeout},
+		{func(c *Config) { c.StrictConfig = true }, ErrInvalidConcurrentBase},
+		{func(c *Config) { c.StrictConfig = true; c.ConcurrentBase = 1 }, ErrInvalidPoolTimeout},
+		{func(c *Config) { c.StrictConfig = true; c.ConcurrentBase = 1; c.PoolTimeout = time.Second }, ErrInvalidIdleCheckFrequency},
+	} {
+		poolConfig := valid()
+		tc.modify(poolConfig)
+		if err := poolConfig.Validate(); !errors.Is(err, tc.want) {
+			t.Errorf("Expected error \"%s\" but got \"%v\"", tc.want, err)
+		}
+		if _, err := NewChannelPool(poolConfig); !errors.Is(err, tc.want) {
+			t.Errorf("Expected error \"%s\" from NewChannelPool but got \"%v\"", tc.want, err)
+		}
+	}
+}
+
+type testSession struct {
+	conn interface{}
+}
+
+func TestChannelPool_WrapUnwrap(t *testing.T) {
+	var unwrapped int32
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     1,
+		Factory:    factory,
+		Close:      closer,
+		Ping:       NetConnPing(),
+		Wrap: func(conn interface{}) (interface{}, error) {
+			return &testSession{conn: conn}, nil
+		},
+		Unwrap: func(wrapped interface{}) (interface{}, error) {
+			atomic.AddInt32(&unwrapped, 1)
+			return wrapped.(*testSession).conn, nil
+		},
+	})
+	defer p.Release()
+
+	wrapConn, _ := p.Get()
+	conn, _ := wrapConn.Get()
+	session, ok := conn.(*testSession)
+	if !ok {
+		t.Fatalf("Get returned %T but should return *testSession", conn)
+	}
+	if err := p.Ping(wrapConn); err != nil {
+		t.Errorf("Ping of the wrapped conn returned an error: %s", err)
+	}
+	p.Put(wrapConn)
+	if n := atomic.LoadInt32(&unwrapped); n != 1 {
+		t.Errorf("Unwrap was called %d times but should be 1", n)
+	}
+
+	// 连接池中保存的是原来的连接，再次 Get 时重新包装
+	stored := p.(*channelPool).getIdle().snapshot()
+	if len(stored) != 1 || stored[0].conn != session.conn {
+		t.Fatal("The pool should store the underlying conn")
+	}
+	wrapConn, _ = p.Get()
+	conn, _ = wrapConn.Get()
+	if again, ok := conn.(*testSession); !ok || again == session || again.conn != session.conn {
+		t.Errorf("Get returned %v but should wrap the same underlying conn in a new session", conn)
+	}
+	p.Put(wrapConn)
+}
+
+func TestChannelPool_SkipStaleIdle(t *testing.T) {
+	factory, closer, stats := NewMockFactory()
+	p, _ := NewChannelPool(&Config{
+		InitialCap:         0,
+		MaxCap:             2,
+		Factory:            factory,
+		Close:              closer,
+		IdleTimeout:        50 * time.Millisecond,
+		IdleCheckFrequency: -1,
+		PoolFIFO:           true,
+	})
+	defer p.Release()
+
+	conns, _ := p.BatchGet(2)
+	p.Put(conns[0])
+	time.Sleep(60 * time.Millisecond)
+	want, _ := conns[1].ID()
+	p.Put(conns[1])
+
+	// 先取出的已超时，应跳过并返回下一个空闲连接而不是新建
+	wrapConn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	if id, _ := wrapConn.ID(); id != want {
+		t.Errorf("Get returned conn %d but should return the fresh idle conn %d", id, want)
+	}
+	if n := stats.Created(); n != 2 {
+		t.Errorf("%d conns were created but should be 2", n)
+	}
+	if n := stats.Closed(); n != 1 {
+		t.Errorf("%d conns were closed but should be 1", n)
+	}
+	p.Put(wrapConn)
+}
+
+func TestChannelPool_ReleaseAndWait(t *testing.T) {
+	errClose := errors.New("close failed")
+	var closed int32
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 20,
+		MaxCap:     20,
+		Factory:    factory,
+		Close: func(conn interface{}) error {
+			time.Sleep(20 * time.Millisecond)
+			closer(conn)
+			if atomic.AddInt32(&closed, 1) <= 2 {
+				return errClose
+			}
+			return nil
+		},
+		ReleaseCloseTimeout: time.Millisecond,
+	})
+
+	err := p.ReleaseAndWait(context.Background())
+	if n := atomic.LoadInt32(&closed); n != 20 {
+		t.Errorf("ReleaseAndWait returned after %d closes but should wait for 20", n)
+	}
+	var closeErrs CloseErrors
+	if !errors.As(err, &closeErrs) || len(closeErrs) != 2 || closeErrs[0] != errClose {
+		t.Errorf("Expected 2 \"%s\" errors but got \"%v\"", errClose, err)
+	}
+	if !errors.Is(err, errClose) {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", errClose, err)
+	}
+
+	// ctx 先超时时不等待剩余的关闭
+	atomic.StoreInt32(&closed, 0)
+	p.Warmup(20)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.ReleaseAndWait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", context.DeadlineExceeded, err)
+	}
+	p.ClosePool()
+}
+
+func TestChannelPool_PutErr(t *testing.T) {
+	var reasons []CloseReason
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     2,
+		Factory:    factory,
+		Close:      closer,
+		OnClose: func(conn interface{}, reason CloseReason) {
+			reasons = append(reasons, reason)
+		},
+	})
+	defer p.Release()
+
+	wrapConn, _ := p.Get()
+	if err := p.PutErr(wrapConn, nil); err != nil {
+		t.Errorf("PutErr returned an error: %s", err)
+	}
+	if a := p.Len(); a != 1 {
+		t.Errorf("The pool available was %d but should be 1", a)
+	}
+
+	wrapConn, _ = p.Get()
+	broken, _ := wrapConn.Get()
+	if err := p.PutErr(wrapConn, errors.New("write failed")); err != nil {
+		t.Errorf("PutErr returned an error: %s", err)
+	}
+	if a := p.Len(); a != 0 {
+		t.Errorf("The pool available was %d but should be 0", a)
+	}
+	if q := len(p.(*channelPool).getQueue()); q != 0 {
+		t.Errorf("The queue length was %d but should be 0", q)
+	}
+	if len(reasons) != 1 || reasons[0] != ReasonBroken {
+		t.Errorf("The close reasons were %v but should be [broken]", reasons)
+	}
+
+	wrapConn, _ = p.Get()
+	if conn, _ := wrapConn.Get(); conn == broken {
+		t.Error("The broken conn re-entered the pool")
+	}
+	p.Put(wrapConn)
+}
+
+func TestChannelPool_Stress(t *testing.T) {
+	factory, closer, stats := NewMockFactory()
+	p, _ := NewChannelPool(&Config{
+		InitialCap:           2,
+		MaxCap:               8,
+		Factory:              factory,
+		Close:                closer,
+		Ping:                 stats.Ping,
+		PoolTimeout:          10 * time.Millisecond,
+		IdleTimeout:          5 * time.Millisecond,
+		IdleCheckFrequency:   time.Millisecond,
+		HealthCheckFrequency: time.Millisecond,
+		MinIdle:              1,
+		DetectReuse:          true,
+	})
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	worker := func(fn func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				fn(i)
+			}
+		}()
+	}
+
+	for n := 0; n < 16; n++ {
+		worker(func(i int) {
+			wrapConn, err := p.Get()
+			if err != nil {
+				return
+			}
+			if _, err := wrapConn.Get(); err != nil {
+				t.Errorf("Get returned a closed conn: %s", err)
+			}
+			p.Ping(wrapConn)
+			switch i % 4 {
+			case 0:
+				p.Close(wrapConn)
+			case 1:
+				p.PutErr(wrapConn, errors.New("broken"))
+			default:
+				p.Put(wrapConn)
+			}
+		})
+	}
+	worker(func(i int) {
+		if c, err := p.TryGet(); err == nil {
+			p.Put(c)
+		}
+	})
+	worker(func(i int) {
+		p.Len()
+		p.InUse()
+		p.Stats()
+		p.ForEach(func(interface{}, time.Time) bool { return i%2 == 0 })
+	})
+	worker(func(i int) {
+		time.Sleep(5 * time.Millisecond)
+		if i%2 == 0 {
+			p.Release()
+		} else {
+			p.Drain()
+		}
+	})
+
+	time.Sleep(300 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	p.ClosePool()
+	if n := stats.Open(); n != 0 {
+		t.Errorf("%d conns were still open but should be 0", n)
+	}
+}
+
+func TestChannelPool_ConnLeakThreshold(t *testing.T) {
+	logger := &testLogger{}
+	p, _ := NewChannelPool(&Config{
+		InitialCap:        2,
+		MaxCap:            2,
+		Factory:           factory,
+		Close:             closer,
+		Logger:            logger,
+		ConnLeakThreshold: 20 * time.Millisecond,
+		ConnLeakStack:     true,
+	})
+	defer p.Release()
+
+	leaked, _ := p.Get()
+	returned, _ := p.Get()
+	p.Put(returned)
+
+	deadline := time.Now().Add(time.Second)
+	for logger.Len() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	logger.mu.Lock()
+	logs := append([]string(nil), logger.logs...)
+	logger.mu.Unlock()
+	if len(logs) != 1 {
+		t.Fatalf("%d leaks were logged but should be 1: %v", len(logs), logs)
+	}
+	id, _ := leaked.ID()
+	if !strings.Contains(logs[0], fmt.Sprintf("conn %d not returned", id)) || !strings.Contains(logs[0], "TestChannelPool_ConnLeakThreshold") {
+		t.Errorf("The leak log %q should name conn %d and the borrow site", logs[0], id)
+	}
+	p.Put(leaked)
+}
+
+func TestChannelPool_NewConnRateLimit(t *testing.T) {
+	factory, closer, stats := NewMockFactory()
+	p, _ := NewChannelPool(&Config{
+		InitialCap:       0,
+		MaxCap:           10,
+		Factory:          factory,
+		Close:            closer,
+		NewConnRateLimit: 2,
+	})
+	defer p.Release()
+
+	var limited int
+	for i := 0; i < 10; i++ {
+		start := time.Now()
+		_, err := p.Get()
+		if err == ErrRateLimited {
+			limited++
+			if d := time.Since(start); d > 100*time.Millisecond {
+				t.Errorf("A rate limited Get took %s but should fail fast", d)
+			}
+		}
+	}
+	if limited != 8 {
+		t.Errorf("%d Gets were rate limited but should be 8", limited)
+	}
+	if n := stats.Created(); n != 2 {
+		t.Errorf("%d conns were created but should be 2", n)
+	}
+	if q := len(p.(*channelPool).getQueue()); q != 2 {
+		t.Errorf("The queue length was %d but should be 2", q)
+	}
+	if _, err := p.TryGet(); err != ErrRateLimited {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrRateLimited, err)
+	}
+}
+
+func TestChannelPool_LazyWarmup(t *testing.T) {
+	start := time.Now()
+	p, err := NewChannelPool(&Config{
+		InitialCap: 0,
+		MaxCap:     5,
+		Factory: func() (interface{}, error) {
+			time.Sleep(20 * time.Millisecond)
+			return factory()
+		},
+		Close:        closer,
+		LazyWarmup:   true,
+		WarmupTarget: 3,
+	})
+	if err != nil {
+		t.Fatalf("NewChannelPool error: %s", err)
+	}
+	defer p.Release()
+
+	if d := time.Since(start); d > 10*time.Millisecond {
+		t.Errorf("NewChannelPool took %s but should not wait for the warmup", d)
+	}
+	if a := p.Len(); a != 0 {
+		t.Errorf("The pool available was %d but should be 0", a)
+	}
+
+	select {
+	case <-p.Ready():
+	case <-time.After(time.Second):
+		t.Fatal("The lazy warmup did not finish")
+	}
+	if a := p.Len(); a != 3 {
+		t.Errorf("The pool available was %d but should be 3", a)
+	}
+}
+
+func TestChannelPool_LazyWarmupAlreadyFilled(t *testing.T) {
+	p, err := NewChannelPool(&Config{
+		InitialCap:   3,
+		MaxCap:       5,
+		Factory:      factory,
+		Close:        closer,
+		LazyWarmup:   true,
+		WarmupTarget: 2,
+	})
+	if err != nil {
+		t.Fatalf("NewChannelPool error: %s", err)
+	}
+	defer p.Release()
+
+	select {
+	case <-p.Ready():
+	case <-time.After(time.Second):
+		t.Fatal("Ready did not fire when InitialCap already met WarmupTarget")
+	}
+	if a := p.Len(); a != 3 {
+		t.Errorf("The pool available was %d but should be 3", a)
+	}
+}
+
+func TestChannelPool_Generation(t *testing.T) {
+	factory, closer, _ := NewMockFactory()
+	p, err := NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     2,
+		Factory:    factory,
+		Close:      closer,
+	})
+	if err != nil {
+		t.Fatalf("NewChannelPool error: %s", err)
+	}
+	defer p.Release()
+
+	wrapConn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	if stale, err := wrapConn.Stale(); err != nil || stale {
+		t.Errorf("The conn was stale %v (%v) but should be false", stale, err)
+	}
+
+	gen := p.Generation()
+	p.Release()
+	if g := p.Generation(); g != gen+1 {
+		t.Errorf("The generation was %d but should be %d", g, gen+1)
+	}
+	if stale, err := wrapConn.Stale(); err != nil || !stale {
+		t.Errorf("The conn was stale %v (%v) but should be true", stale, err)
+	}
+
+	p.Put(wrapConn)
+	if _, err := wrapConn.Stale(); err != ErrConnClosed {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrConnClosed, err)
+	}
+}
+
+func TestChannelPool_GetAffinity(t *testing.T) {
+	factory, closer, _ := NewMockFactory()
+	p, err := NewChannelPool(&Config{
+		InitialCap: 0,
+		MaxCap:     3,
+		Factory:    factory,
+		Close:      closer,
+	})
+	if err != nil {
+		t.Fatalf("NewChannelPool error: %s", err)
+	}
+	defer p.Release()
+
+	a, err := p.GetAffinity("A")
+	if err != nil {
+		t.Fatalf("GetAffinity error: %s", err)
+	}
+	connA, _ := a.Get()
+	b, err := p.GetAffinity("B")
+	if err != nil {
+		t.Fatalf("GetAffinity error: %s", err)
+	}
+	p.Put(a)
+	p.Put(b)
+
+	// LIFO 时 Get 会取到 B 的连接，GetAffinity 仍取 A 的连接
+	wrapConn, err := p.GetAffinity("A")
+	if err != nil {
+		t.Fatalf("GetAffinity error: %s", err)
+	}
+	if conn, _ := wrapConn.Get(); conn != connA {
+		t.Errorf("GetAffinity(\"A\") returned conn %d but should return conn %d", conn.(*MockConn).ID, connA.(*MockConn).ID)
+	}
+	if wrapConn.Fresh() {
+		t.Error("GetAffinity(\"A\") created a new conn but should reuse the idle one")
+	}
+	p.Put(wrapConn)
+
+	// 没有相同 key 的连接时使用任意空闲连接
+	wrapConn, err = p.GetAffinity("C")
+	if err != nil {
+		t.Fatalf("GetAffinity error: %s", err)
+	}
+	if wrapConn.Fresh() {
+		t.Error("GetAffinity(\"C\") created a new conn but should reuse an idle one")
+	}
+	p.Put(wrapConn)
+
+	// Get 取出的连接不再属于之前的 key，C 的连接在 LIFO 时最先取出、最先放回
+	first, _ := p.Get()
+	second, _ := p.Get()
+	connSecond, _ := second.Get()
+	p.Put(first)
+	p.Put(second)
+	wrapConn, err = p.GetAffinity("C")
+	if err != nil {
+		t.Fatalf("GetAffinity error: %s", err)
+	}
+	if conn, _ := wrapConn.Get(); conn != connSecond {
+		t.Errorf("GetAffinity(\"C\") returned conn %d but should return conn %d", conn.(*MockConn).ID, connSecond.(*MockConn).ID)
+	}
+	p.Put(wrapConn)
+}
+
+func TestChannelPool_InvalidateAll(t *testing.T) {
+	factory, closer, stats := NewMockFactory()
+	var reasons []CloseReason
+	var mu sync.Mutex
+	p, err := NewChannelPool(&Config{
+		InitialCap: 2,
+		MaxCap:     3,
+		Factory:    factory,
+		Close:      closer,
+		OnClose: func(conn interface{}, reason CloseReason) {
+			mu.Lock()
+			reasons = append(reasons, reason)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewChannelPool error: %s", err)
+	}
+	defer p.Release()
+
+	borrowed, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	p.InvalidateAll()
+
+	// 不立即关闭空闲连接
+	if a := p.Len(); a != 1 {
+		t.Errorf("The pool available was %d but should be 1", a)
+	}
+	if n := stats.Closed(); n != 0 {
+		t.Errorf("%d conns were closed but should be 0", n)
+	}
+	if stale, _ := borrowed.Stale(); !stale {
+		t.Error("The borrowed conn was not stale after InvalidateAll")
+	}
+
+	wrapConn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get error: %s", err)
+	}
+	if !wrapConn.Fresh() {
+		t.Error("Get returned an invalidated idle conn but should create a new one")
+	}
+
+	if err := p.Put(borrowed); err != nil {
+		t.Errorf("Put error: %s", err)
+	}
+	if conn, _ := borrowed.Get(); conn != nil {
+		t.Error("The borrowed conn was not closed on Put")
+	}
+	p.Put(wrapConn)
+	if a := p.Len(); a != 1 {
+		t.Errorf("The pool available was %d but should be 1", a)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reasons) != 2 || reasons[0] != ReasonInvalidated || reasons[1] != ReasonInvalidated {
+		t.Errorf("The close reasons were %v but should be [invalidated invalidated]", reasons)
+	}
+}
+
+func TestChannelPool_GetMultiContext(t *testing.T) {
+	factory, closer, _ := NewMockFactory()
+	p, err := NewChannelPool(&Config{
+		InitialCap:     0,
+		MaxCap:         2,
+		ConcurrentBase: 1,
+		Factory:        factory,
+		Close:          closer,
+	})
+	if err != nil {
+		t.Fatalf("NewChannelPool error: %s", err)
+	}
+	defer p.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	conns, err := p.GetMultiContext(ctx, 4)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", context.DeadlineExceeded, err)
+	}
+	if len(conns) != 2 {
+		t.Fatalf("%d conns were returned but should be 2", len(conns))
+	}
+	if n := p.InUse(); n != 2 {
+		t.Errorf("%d conns were in use but should be 2", n)
+	}
+
+	for _, wrapConn := range conns {
+		p.Put(wrapConn)
+	}
+	if a := p.Len(); a != 2 {
+		t.Errorf("The pool available was %d but should be 2", a)
+	}
+}
+
+func TestChannelPool_KeepAlive(t *testing.T) {
+	factory, closer, stats := NewMockFactory()
+	var mu sync.Mutex
+	calls := make(map[uint64]int)
+	var failID uint64
+	p, err := NewChannelPool(&Config{
+		InitialCap: 3,
+		MaxCap:     3,
+		Factory:    factory,
+		Close:      closer,
+		KeepAliveFunc: func(conn interface{}) error {
+			mu.Lock()
+			defer mu.Unlock()
+			id := conn.(*MockConn).ID
+			calls[id]++
+			if id == failID {
+				return errors.New("keepalive failed")
+			}
+			return nil
+		},
+		KeepAliveFrequency: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewChannelPool error: %s", err)
+	}
+	defer p.Release()
+
+	before := p.Dump()
+	time.Sleep(55 * time.Millisecond)
+
+	mu.Lock()
+	for id := uint64(1); id <= 3; id++ {
+		if calls[id] < 2 {
+			t.Errorf("KeepAliveFunc was called %d times for conn %d but should be at least 2", calls[id], id)
+		}
+	}
+	failID = 2
+	mu.Unlock()
+
+	// 不改变空闲时间
+	after := p.Dump()
+	for i := range before {
+		if !after[i].LastUsed.Equal(before[i].LastUsed) {
+			t.Errorf("The idle time of conn %d changed from %s to %s", after[i].ID, before[i].LastUsed, after[i].LastUsed)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for p.Len() != 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if a := p.Len(); a != 2 {
+		t.Errorf("The pool available was %d but should be 2", a)
+	}
+	if n := stats.Closed(); n != 1 {
+		t.Errorf("%d conns were closed but should be 1", n)
+	}
+}
+
+func TestChannelPool_StatsDoesNotDisturbIdle(t *testing.T) {
+	factory, closer, stats := NewMockFactory()
+	p, err := NewChannelPool(&Config{
+		InitialCap: 4,
+		MaxCap:     4,
+		Factory:    factory,
+		Close:      closer,
+	})
+	if err != nil {
+		t.Fatalf("NewChannelPool error: %s", err)
+	}
+	defer p.Release()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if wrapConn, err := p.Get(); err == nil {
+					p.Put(wrapConn)
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			p.Stats()
+			p.DOT()
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	if n := stats.Created(); n != 4 {
+		t.Errorf("%d conns were created but should be 4", n)
+	}
+	if n := stats.Closed(); n != 0 {
+		t.Errorf("%d conns were closed but should be 0", n)
+	}
+}
@@ -0,0 +1,61 @@
+// Package promcollector 将连接池的 Stats 导出为 Prometheus 指标，
+// 单独作为一个 module，使用连接池时不需要依赖 Prometheus
+package promcollector
+
+import (
+	"github.com/dryyun/go-pool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector 实现 prometheus.Collector，每次采集时调用 Pool.Stats
+type Collector struct {
+	pool go_pool.Pool
+
+	idleConns  *prometheus.Desc
+	totalConns *prometheus.Desc
+	hits       *prometheus.Desc
+	misses     *prometheus.Desc
+	timeouts   *prometheus.Desc
+	waitCount  *prometheus.Desc
+	waitSecs   *prometheus.Desc
+}
+
+// NewCollector 创建 p 的 Collector，poolName 作为 pool 标签区分多个连接池
+func NewCollector(p go_pool.Pool, poolName string) *Collector {
+	labels := prometheus.Labels{"pool": poolName}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("go_pool_"+name, help, nil, labels)
+	}
+
+	return &Collector{
+		pool:       p,
+		idleConns:  desc("idle_conns", "Number of idle connections."),
+		totalConns: desc("conns", "Number of live connections, idle and in use."),
+		hits:       desc("hits_total", "Number of Gets served by an idle connection."),
+		misses:     desc("misses_total", "Number of Gets that created a new connection."),
+		timeouts:   desc("timeouts_total", "Number of Gets that timed out."),
+		waitCount:  desc("waits_total", "Number of Gets that had to wait."),
+		waitSecs:   desc("wait_seconds_total", "Total time Gets spent waiting."),
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.idleConns
+	ch <- c.totalConns
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.timeouts
+	ch <- c.waitCount
+	ch <- c.waitSecs
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	s := c.pool.Stats()
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(s.IdleConns))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(s.TotalConns))
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(s.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(s.Misses))
+	ch <- prometheus.MustNewConstMetric(c.timeouts, prometheus.CounterValue, float64(s.Timeouts))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(s.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitSecs, prometheus.CounterValue, s.WaitDuration.Seconds())
+}
@@ -0,0 +1,63 @@
+package promcollector
+
+import (
+	"testing"
+
+	"github.com/dryyun/go-pool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollector(t *testing.T) {
+	p, err := go_pool.NewChannelPool(&go_pool.Config{
+		InitialCap: 2,
+		MaxCap:     4,
+		Factory:    func() (interface{}, error) { return new(int), nil },
+		Close:      func(interface{}) error { return nil },
+	})
+	if err != nil {
+		t.Fatalf("NewChannelPool error: %s", err)
+	}
+	defer p.Release()
+
+	c1, _ := p.Get()
+	c2, _ := p.Get()
+	c3, _ := p.Get()
+	p.Put(c1)
+	p.Put(c2)
+	p.Put(c3)
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(NewCollector(p, "test"))
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather error: %s", err)
+	}
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		m := family.GetMetric()[0]
+		if l := m.GetLabel(); len(l) != 1 || l[0].GetValue() != "test" {
+			t.Errorf("%s has labels %v but should have pool=\"test\"", family.GetName(), l)
+		}
+		if g := m.GetGauge(); g != nil {
+			values[family.GetName()] = g.GetValue()
+		} else {
+			values[family.GetName()] = m.GetCounter().GetValue()
+		}
+	}
+
+	want := map[string]float64{
+		"go_pool_idle_conns":         3,
+		"go_pool_conns":              3,
+		"go_pool_hits_total":         2,
+		"go_pool_misses_total":       1,
+		"go_pool_timeouts_total":     0,
+		"go_pool_waits_total":        0,
+		"go_pool_wait_seconds_total": 0,
+	}
+	for name, v := range want {
+		if got, ok := values[name]; !ok || got != v {
+			t.Errorf("%s was %v but should be %v", name, got, v)
+		}
+	}
+}
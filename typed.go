@@ -0,0 +1,124 @@
+package go_pool
+
+import (
+	"context"
+	"fmt"
+)
+
+// TypedFactory 将返回 T 的生成连接方法转换为 Config.Factory
+func TypedFactory[T any](factory func() (T, error)) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		conn, err := factory()
+		if err != nil {
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+// TypedClose 将关闭 T 的方法转换为 Config.Close
+func TypedClose[T any](close func(T) error) func(interface{}) error {
+	return func(i interface{}) error {
+		conn, err := assertConn[T](i)
+		if err != nil {
+			return err
+		}
+		return close(conn)
+	}
+}
+
+// TypedPing 将检查 T 的方法转换为 Config.Ping
+func TypedPing[T any](ping func(T) error) func(interface{}) error {
+	return TypedClose(ping)
+}
+
+func assertConn[T any](i interface{}) (T, error) {
+	conn, ok := i.(T)
+	if !ok {
+		var zero T
+		return zero, fmt.Errorf("%w: got %T, want %T", ErrConnType, i, zero)
+	}
+	return conn, nil
+}
+
+// TypedPool 基于 Pool 的泛型连接池，取出的连接不需要再做类型断言
+type TypedPool[T any] struct {
+	pool Pool
+}
+
+// TypedConn 泛型连接，Get 直接返回 T
+type TypedConn[T any] struct {
+	*IdleConn
+}
+
+// NewTypedChannelPool 初始化泛型连接池，Factory、Close 可用 TypedFactory、TypedClose 生成
+func NewTypedChannelPool[T any](poolConfig *Config) (*TypedPool[T], error) {
+	pool, err := NewChannelPool(poolConfig)
+	if err != nil {
+		return nil, err
+	}
+	return NewTypedPool[T](pool), nil
+}
+
+// NewTypedPool 包装已有的 Pool
+func NewTypedPool[T any](pool Pool) *TypedPool[T] {
+	return &TypedPool[T]{pool: pool}
+}
+
+// Pool 底层的 Pool
+func (p *TypedPool[T]) Pool() Pool {
+	return p.pool
+}
+
+// Get 从 pool 中取一个连接
+func (p *TypedPool[T]) Get() (*TypedConn[T], error) {
+	return p.wrap(p.pool.Get())
+}
+
+// GetContext 从 pool 中取一个连接，支持 ctx 取消和超时
+func (p *TypedPool[T]) GetContext(ctx context.Context) (*TypedConn[T], error) {
+	return p.wrap(p.pool.GetContext(ctx))
+}
+
+func (p *TypedPool[T]) wrap(wrapConn *IdleConn, err error) (*TypedConn[T], error) {
+	if err != nil {
+		return nil, err
+	}
+	return &TypedConn[T]{IdleConn: wrapConn}, nil
+}
+
+// Put 将连接放回 pool 中
+func (p *TypedPool[T]) Put(conn *TypedConn[T]) error {
+	if conn == nil {
+		return nil
+	}
+	return p.pool.Put(conn.IdleConn)
+}
+
+// Close 关闭单条连接
+func (p *TypedPool[T]) Close(conn *TypedConn[T]) error {
+	if conn == nil {
+		return nil
+	}
+	return p.pool.Close(conn.IdleConn)
+}
+
+// Release 释放连接池中所有连接
+func (p *TypedPool[T]) Release() {
+	p.pool.Release()
+}
+
+// Len 连接池中已有的连接
+func (p *TypedPool[T]) Len() int {
+	return p.pool.Len()
+}
+
+// Get 获取底层连接，类型不是 T 时返回 ErrConnType
+func (c *TypedConn[T]) Get() (T, error) {
+	i, err := c.IdleConn.Get()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return assertConn[T](i)
+}
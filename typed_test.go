@@ -0,0 +1,70 @@
+package go_pool
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func tcpFactory() (*net.TCPConn, error) {
+	addr, err := net.ResolveTCPAddr(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return net.DialTCP(network, nil, addr)
+}
+
+func TestTypedPool(t *testing.T) {
+	p, err := NewTypedChannelPool[*net.TCPConn](&Config{
+		InitialCap: 1,
+		MaxCap:     2,
+		Factory:    TypedFactory(tcpFactory),
+		Close:      TypedClose((*net.TCPConn).Close),
+	})
+	if err != nil {
+		t.Fatalf("The pool returned an error: %s", err.Error())
+	}
+	defer p.Release()
+
+	conn, err := p.Get()
+	if err != nil {
+		t.Fatalf("Get returned an error: %s", err.Error())
+	}
+	tcpConn, err := conn.Get()
+	if err != nil || tcpConn == nil {
+		t.Errorf("conn get returned %v, %v", tcpConn, err)
+	}
+	if a := p.Len(); a != 0 {
+		t.Errorf("The pool available was %d but should be 0", a)
+	}
+
+	if err := p.Put(conn); err != nil {
+		t.Errorf("Put returned an error: %s", err.Error())
+	}
+	if a := p.Len(); a != 1 {
+		t.Errorf("The pool available was %d but should be 1", a)
+	}
+	if _, err := conn.Get(); err != ErrConnClosed {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrConnClosed.Error(), err)
+	}
+}
+
+func TestTypedPool_TypeMismatch(t *testing.T) {
+	p, _ := NewChannelPool(&Config{
+		InitialCap: 1,
+		MaxCap:     1,
+		Factory:    factory,
+		Close:      closer,
+	})
+	defer p.Release()
+
+	typed := NewTypedPool[*net.UDPConn](p)
+	conn, err := typed.Get()
+	if err != nil {
+		t.Fatalf("Get returned an error: %s", err.Error())
+	}
+	if _, err := conn.Get(); !errors.Is(err, ErrConnType) {
+		t.Errorf("Expected error \"%s\" but got \"%v\"", ErrConnType.Error(), err)
+	}
+	typed.Put(conn)
+}